@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/dnjp/zync/proto/zync/v1"
@@ -11,10 +10,11 @@ import (
 )
 
 func (c *client) addFilesCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "add PATTERN",
-		Short: "Adds files matching pattern to zync",
-		Args:  validRegexArg,
+	var patterns patternFlags
+	cmd := &cobra.Command{
+		Use:   "add PATTERN...",
+		Short: "Adds files matching the patterns to zync",
+		Args:  patterns.validArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := c.connect(); err != nil {
 				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
@@ -27,35 +27,36 @@ func (c *client) addFilesCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			pattern := args[0]
-			err = c.add(cwd, pattern)
-			if err != nil {
+			if err := c.add(cwd, args, patterns.patternType()); err != nil {
 				fmt.Fprintf(os.Stderr, "failed to read file: %+v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
+	patterns.register(cmd)
+	return cmd
 }
 
-func (c *client) add(cwd, pattern string) error {
-	fc, err := c.cc.AddFiles(context.TODO(), &zync.RegexRequest{
-		Pattern:          pattern,
-		CurrentDirectory: cwd,
-	})
+func (c *client) add(cwd string, patterns []string, patternType zync.PatternType) error {
+	p, err := c.printer(outputTable)
 	if err != nil {
 		return err
 	}
 
-	for {
-		file, err := fc.Recv()
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		fc, err := c.cc.AddFiles(context.TODO(), &zync.RegexRequest{
+			Pattern:          pattern,
+			CurrentDirectory: cwd,
+			PatternType:      patternType,
+		})
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			return err
 		}
-		fmt.Fprintf(os.Stdout, "file: %+v\n", file)
+		if err := printFiles(p, fc, seen); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return p.flush()
 }
@@ -10,7 +10,8 @@ import (
 )
 
 func (c *client) backupCmd() *cobra.Command {
-	return &cobra.Command{
+	var label string
+	cmd := &cobra.Command{
 		Use:   "backup",
 		Short: "Initiates a full backup, returning the CID used for restores",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -18,21 +19,31 @@ func (c *client) backupCmd() *cobra.Command {
 				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
 				os.Exit(1)
 			}
-			if err := c.backup(); err != nil {
+			if err := c.backup(label); err != nil {
 				fmt.Fprintf(os.Stderr, "error during backup: %+v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
+	cmd.Flags().StringVar(&label, "label", "", "the label of the snapshot, which decides how long it is retained (default is manual)")
+	return cmd
 }
 
-func (c *client) backup() error {
-	status, err := c.cc.Backup(context.TODO(), &zync.BackupRequest{})
+func (c *client) backup(label string) error {
+	p, err := c.printer(outputTable)
 	if err != nil {
 		return err
 	}
 
-	fmt.Fprintf(os.Stdout, "status: %+v\n", status)
+	status, err := c.cc.Backup(context.TODO(), &zync.BackupRequest{
+		Label: label,
+	})
+	if err != nil {
+		return err
+	}
 
-	return nil
+	if err := p.print(newSnapshotOutput(status.Snapshot)); err != nil {
+		return err
+	}
+	return p.flush()
 }
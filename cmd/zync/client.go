@@ -2,19 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"regexp"
+	"os"
+	"strings"
 
+	zyncd "github.com/dnjp/zync/daemon"
 	"github.com/dnjp/zync/proto/zync/v1"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
-const defaultRemote = "localhost:8081"
-
 type client struct {
-	remote string
-	cc     zync.ZyncClient
+	remote   string
+	output   string
+	tls      bool
+	caCert   string
+	cert     string
+	key      string
+	token    string
+	insecure bool
+	cc       zync.ZyncClient
 }
 
 func newClient() *client {
@@ -22,10 +31,14 @@ func newClient() *client {
 }
 
 func (c *client) connect() error {
+	opts, err := c.dialOptions()
+	if err != nil {
+		return err
+	}
 	conn, err := grpc.DialContext(
 		context.Background(),
-		c.remote,
-		grpc.WithInsecure(),
+		strings.TrimPrefix(c.remote, "tcp://"),
+		opts...,
 	)
 	if err != nil {
 		return err
@@ -34,6 +47,44 @@ func (c *client) connect() error {
 	return nil
 }
 
+// dialOptions returns the credentials used to connect to the daemon.
+// Unix sockets are protected by their permissions, so credentials are
+// only presented over TCP
+func (c *client) dialOptions() ([]grpc.DialOption, error) {
+	if strings.HasPrefix(c.remote, "unix:") {
+		return []grpc.DialOption{grpc.WithInsecure()}, nil
+	}
+
+	var opts []grpc.DialOption
+	if c.tls || c.caCert != "" || c.cert != "" || c.insecure {
+		config := &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			InsecureSkipVerify: c.insecure,
+		}
+		if c.caCert != "" {
+			pool, err := zyncd.LoadCertPool(c.caCert)
+			if err != nil {
+				return nil, err
+			}
+			config.RootCAs = pool
+		}
+		if c.cert != "" || c.key != "" {
+			cert, err := tls.LoadX509KeyPair(c.cert, c.key)
+			if err != nil {
+				return nil, err
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if c.token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(zyncd.Token(c.token)))
+	}
+	return opts, nil
+}
+
 func (c *client) rootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:                   "zync COMMAND",
@@ -55,18 +106,65 @@ func (c *client) initCommands(cmd *cobra.Command) {
 	cmd.AddCommand(c.addFilesCmd())
 	cmd.AddCommand(c.listFilesCmd())
 	cmd.AddCommand(c.removeFilesCmd())
+	cmd.AddCommand(c.undoCmd())
 	cmd.AddCommand(c.backupCmd())
+	cmd.AddCommand(c.snapshotsCmd())
+	cmd.AddCommand(c.tagCmd())
 	cmd.AddCommand(c.restoreCmd())
+	cmd.AddCommand(c.conflictsCmd())
+	cmd.AddCommand(c.watchCmd())
+	cmd.AddCommand(c.statusCmd())
+	cmd.AddCommand(c.verifyCmd())
+	cmd.AddCommand(c.reloadCmd())
+	cmd.AddCommand(c.exportCmd())
+	cmd.AddCommand(c.importCmd())
 }
 
 func (c *client) initFlags(cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&c.remote, "url", defaultRemote, "the url to the daemon")
+	cmd.PersistentFlags().StringVar(&c.remote, "url", zyncd.DefaultURL(), "the url to the daemon: unix:///path/to/socket or host:port")
+	cmd.PersistentFlags().BoolVar(&c.tls, "tls", false, "connect to the daemon using tls, verifying it with the system certificate authorities")
+	cmd.PersistentFlags().StringVar(&c.caCert, "ca-cert", "", "the certificate authority used to verify the daemon, implies --tls")
+	cmd.PersistentFlags().StringVar(&c.cert, "cert", "", "the client certificate presented to daemons that require one, implies --tls")
+	cmd.PersistentFlags().StringVar(&c.key, "key", "", "the key of the client certificate")
+	cmd.PersistentFlags().BoolVar(&c.insecure, "insecure-skip-verify", false, "connect using tls without verifying the daemon's certificate, implies --tls")
+	cmd.PersistentFlags().StringVar(&c.token, "token", os.Getenv("ZYNC_TOKEN"), "the token presented to the daemon, defaults to $ZYNC_TOKEN")
+	cmd.PersistentFlags().StringVarP(&c.output, "output", "o", "", "the output format: json, table or paths (default is table, or json for verify)")
+}
+
+// patternFlags select how the patterns given to a command are
+// interpreted: as shell globs, the default, or as regexes
+type patternFlags struct {
+	glob  bool
+	regex bool
+}
+
+func (f *patternFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.glob, "glob", false, "match shell globs, where ** matches any number of directories (default)")
+	cmd.Flags().BoolVar(&f.regex, "regex", false, "match re2 regexes anywhere in the path relative to the current directory, or in the absolute path with --all")
+}
+
+func (f *patternFlags) patternType() zync.PatternType {
+	if f.regex {
+		return zync.PatternType_PATTERN_TYPE_REGEX
+	}
+	return zync.PatternType_PATTERN_TYPE_GLOB
 }
 
-func validRegexArg(cmd *cobra.Command, args []string) error {
-	if len(args) < 1 {
-		return fmt.Errorf("missing file pattern")
+// validArgs checks that every argument is a valid pattern, requiring at
+// least min of them
+func (f *patternFlags) validArgs(min int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if f.glob && f.regex {
+			return fmt.Errorf("--glob and --regex cannot be used together")
+		}
+		if len(args) < min {
+			return fmt.Errorf("missing file pattern")
+		}
+		for _, pattern := range args {
+			if _, err := zyncd.CompilePattern(pattern, f.patternType(), "/"); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	_, err := regexp.Compile(args[0])
-	return err
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) conflictsCmd() *cobra.Command {
+	var patterns patternFlags
+	var policy string
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "conflicts [pattern]",
+		Short: "Lists unresolved conflicts matching the given pattern, optionally resolving them",
+		Args:  cobra.MatchAll(cobra.MaximumNArgs(1), patterns.validArgs(0)),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+
+			cwd, err := os.Getwd()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read file: %+v\n", err)
+				os.Exit(1)
+			}
+
+			var pattern string
+			if len(args) > 0 {
+				pattern = args[0]
+			}
+
+			if policy != "" {
+				err = c.resolveConflicts(&zync.ResolveRequest{
+					Pattern:          pattern,
+					CurrentDirectory: cwd,
+					Policy:           policy,
+					PatternType:      patterns.patternType(),
+					All:              all,
+				})
+			} else {
+				err = c.conflicts(&zync.RegexRequest{
+					Pattern:          pattern,
+					CurrentDirectory: cwd,
+					PatternType:      patterns.patternType(),
+					All:              all,
+				})
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error handling conflicts: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	patterns.register(cmd)
+	cmd.Flags().StringVar(&policy, "resolve", "", "resolve the matching conflicts using prefer-local, prefer-remote or keep-both")
+	cmd.Flags().BoolVar(&all, "all", false, "match conflicts anywhere, rather than only within the current directory")
+	return cmd
+}
+
+func (c *client) conflicts(req *zync.RegexRequest) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	cc, err := c.cc.ListConflicts(context.TODO(), req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		conflict, err := cc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := p.print(newConflictOutput(conflict)); err != nil {
+			return err
+		}
+	}
+
+	return p.flush()
+}
+
+func (c *client) resolveConflicts(req *zync.ResolveRequest) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	cc, err := c.cc.ResolveConflicts(context.TODO(), req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		conflict, err := cc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := p.print(newConflictOutput(conflict)); err != nil {
+			return err
+		}
+	}
+
+	return p.flush()
+}
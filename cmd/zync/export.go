@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) exportCmd() *cobra.Command {
+	var format, file string
+	cmd := &cobra.Command{
+		Use:   "export CID|TAG|NAME",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Writes the snapshot held at the given CID, tag or IPNS name to a tar or CAR archive",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := c.export(args[0], format, file); err != nil {
+				fmt.Fprintf(os.Stderr, "error during export: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "tar", "the archive format: tar, holding every file at its path, or car, holding every IPFS block")
+	cmd.Flags().StringVarP(&file, "file", "f", "", "the file the archive is written to (default is stdout)")
+	return cmd
+}
+
+func (c *client) export(cid, format, file string) error {
+	ec, err := c.cc.Export(context.TODO(), &zync.ExportRequest{
+		Cid:    cid,
+		Format: format,
+	})
+	if err != nil {
+		return err
+	}
+
+	if file == "" {
+		return receiveArchive(ec, os.Stdout)
+	}
+
+	// write to a temporary file so that a failed export does not leave
+	// a partial archive behind
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".zync-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := receiveArchive(ec, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func receiveArchive(ec zync.Zync_ExportClient, w io.Writer) error {
+	for {
+		chunk, err := ec.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
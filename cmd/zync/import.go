@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) importCmd() *cobra.Command {
+	var format, root string
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Args:  cobra.MinimumNArgs(1),
+		Short: "Uploads the contents of a tar or CAR archive, or - for stdin, returning the CID of a snapshot that can be restored",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := c.importArchive(args[0], format, root); err != nil {
+				fmt.Fprintf(os.Stderr, "error during import: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&format, "format", "", "the archive format: tar or car (default is detected from the archive)")
+	cmd.Flags().StringVar(&root, "root", "/", "the directory the files in a tar archive are restored to")
+	return cmd
+}
+
+func (c *client) importArchive(file, format, root string) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ic, err := c.cc.Import(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	req := &zync.ImportRequest{
+		Format: format,
+		Root:   root,
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			req.Data = buf[:n]
+			if err := ic.Send(req); err != nil {
+				// the daemon stopped reading, and reports why on close
+				break
+			}
+			req = &zync.ImportRequest{}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	status, err := ic.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+
+	err = p.print(&importOutput{
+		CID:     status.Cid,
+		Files:   status.Files,
+		Skipped: status.Skipped,
+	})
+	if err != nil {
+		return err
+	}
+	return p.flush()
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/dnjp/zync/proto/zync/v1"
@@ -11,9 +10,12 @@ import (
 )
 
 func (c *client) listFilesCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "ls [pattern]",
-		Short: "Lists the files matching the given pattern stored in ipfs",
+	var patterns patternFlags
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "ls [PATTERN...]",
+		Short: "Lists the files matching the given patterns stored in ipfs",
+		Args:  patterns.validArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := c.connect(); err != nil {
 				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
@@ -26,38 +28,43 @@ func (c *client) listFilesCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			var pattern string
-			if len(args) > 0 {
-				pattern = args[0]
-			}
-
-			if err := c.ls(cwd, pattern); err != nil {
+			if err := c.ls(cwd, args, patterns.patternType(), all); err != nil {
 				fmt.Fprintf(os.Stderr, "error listing files: %+v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
+	patterns.register(cmd)
+	cmd.Flags().BoolVar(&all, "all", false, "list matching files anywhere, rather than only within the current directory")
+	return cmd
 }
 
-func (c *client) ls(cwd, pattern string) error {
-	fc, err := c.cc.ListFiles(context.TODO(), &zync.RegexRequest{
-		Pattern:          pattern,
-		CurrentDirectory: cwd,
-	})
+func (c *client) ls(cwd string, patterns []string, patternType zync.PatternType, all bool) error {
+	p, err := c.printer(outputTable)
 	if err != nil {
 		return err
 	}
 
-	for {
-		file, err := fc.Recv()
+	// without patterns every file is listed
+	if len(patterns) == 0 {
+		patterns = []string{""}
+	}
+
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		fc, err := c.cc.ListFiles(context.TODO(), &zync.RegexRequest{
+			Pattern:          pattern,
+			CurrentDirectory: cwd,
+			PatternType:      patternType,
+			All:              all,
+		})
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			return err
 		}
-		fmt.Fprintf(os.Stdout, "file: %+v\n", file)
+		if err := printFiles(p, fc, seen); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return p.flush()
 }
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	zyncd "github.com/dnjp/zync/daemon"
+	"github.com/dnjp/zync/proto/zync/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The formats supported by the --output flag
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+	outputPaths = "paths"
+)
+
+// output is implemented by everything the client prints
+type output interface {
+	// columns returns the header of the table, or nil if the table
+	// has no header
+	columns() []string
+	// rows returns the table rows
+	rows() [][]string
+	// paths returns the paths printed in paths mode
+	paths() []string
+}
+
+// printer prints outputs in the format selected with --output. JSON is
+// printed as one object per line so that streams can be consumed as
+// they arrive
+type printer struct {
+	format  string
+	w       io.Writer
+	tw      *tabwriter.Writer
+	headed  bool
+	flushes bool
+}
+
+// printer returns a printer for the format selected with --output,
+// falling back to the given format when none was selected
+func (c *client) printer(fallback string) (*printer, error) {
+	format := c.output
+	if format == "" {
+		format = fallback
+	}
+	switch format {
+	case outputJSON, outputTable, outputPaths:
+	default:
+		return nil, fmt.Errorf(
+			"unknown output format %q. must be one of %s, %s or %s",
+			format,
+			outputJSON,
+			outputTable,
+			outputPaths,
+		)
+	}
+	return &printer{
+		format: format,
+		w:      os.Stdout,
+		tw:     tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0),
+	}, nil
+}
+
+// streaming causes table rows to be flushed as soon as they are printed,
+// for streams that never end
+func (p *printer) streaming() *printer {
+	p.flushes = true
+	return p
+}
+
+func (p *printer) print(o output) error {
+	switch p.format {
+	case outputJSON:
+		b, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "%s\n", b)
+		return err
+	case outputPaths:
+		for _, path := range o.paths() {
+			if _, err := fmt.Fprintln(p.w, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !p.headed {
+		p.headed = true
+		if columns := o.columns(); columns != nil {
+			fmt.Fprintln(p.tw, strings.Join(columns, "\t"))
+		}
+	}
+	for _, row := range o.rows() {
+		fmt.Fprintln(p.tw, strings.Join(row, "\t"))
+	}
+	if p.flushes {
+		return p.tw.Flush()
+	}
+	return nil
+}
+
+// flush writes any buffered table rows
+func (p *printer) flush() error {
+	return p.tw.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func toTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+type fileOutput struct {
+	AbsolutePath string     `json:"absolute_path"`
+	CID          string     `json:"cid"`
+	Checksum     string     `json:"checksum"`
+	Size         int64      `json:"size"`
+	ModTime      *time.Time `json:"mod_time"`
+	Status       string     `json:"status"`
+}
+
+func newFileOutput(file *zync.File) *fileOutput {
+	return &fileOutput{
+		AbsolutePath: file.AbsolutePath,
+		CID:          file.Cid,
+		Checksum:     file.Checksum,
+		Size:         file.Size,
+		ModTime:      toTime(file.ModTime),
+		Status:       file.Status,
+	}
+}
+
+func (f *fileOutput) columns() []string {
+	return []string{"PATH", "SIZE", "MODIFIED", "STATUS", "CID"}
+}
+
+func (f *fileOutput) rows() [][]string {
+	return [][]string{{
+		f.AbsolutePath,
+		zyncd.FormatSize(f.Size),
+		formatTime(f.ModTime),
+		orDash(f.Status),
+		orDash(f.CID),
+	}}
+}
+
+func (f *fileOutput) paths() []string {
+	return []string{f.AbsolutePath}
+}
+
+// fileStream is implemented by the streams of files returned by the
+// daemon
+type fileStream interface {
+	Recv() (*zync.File, error)
+}
+
+// printFiles prints every file received from the stream, skipping the
+// files already seen
+func printFiles(p *printer, stream fileStream, seen map[string]bool) error {
+	for {
+		file, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if seen[file.AbsolutePath] {
+			continue
+		}
+		seen[file.AbsolutePath] = true
+		if err := p.print(newFileOutput(file)); err != nil {
+			return err
+		}
+	}
+}
+
+type conflictOutput struct {
+	AbsolutePath string     `json:"absolute_path"`
+	LocalCID     string     `json:"local_cid"`
+	RemoteCID    string     `json:"remote_cid"`
+	DetectedAt   *time.Time `json:"detected_at"`
+	Resolution   string     `json:"resolution"`
+}
+
+func newConflictOutput(conflict *zync.Conflict) *conflictOutput {
+	if conflict == nil {
+		return nil
+	}
+	return &conflictOutput{
+		AbsolutePath: conflict.AbsolutePath,
+		LocalCID:     conflict.LocalCid,
+		RemoteCID:    conflict.RemoteCid,
+		DetectedAt:   toTime(conflict.DetectedAt),
+		Resolution:   conflict.Resolution,
+	}
+}
+
+func (c *conflictOutput) columns() []string {
+	return []string{"PATH", "DETECTED", "RESOLUTION", "LOCAL CID", "REMOTE CID"}
+}
+
+func (c *conflictOutput) rows() [][]string {
+	return [][]string{{
+		c.AbsolutePath,
+		formatTime(c.DetectedAt),
+		orDash(c.Resolution),
+		orDash(c.LocalCID),
+		orDash(c.RemoteCID),
+	}}
+}
+
+func (c *conflictOutput) paths() []string {
+	return []string{c.AbsolutePath}
+}
+
+type restoreOutput struct {
+	PercentCompleted float64         `json:"percent_completed"`
+	File             *fileOutput     `json:"file"`
+	Conflict         *conflictOutput `json:"conflict"`
+}
+
+func (r *restoreOutput) columns() []string {
+	return []string{"PROGRESS", "PATH", "SIZE", "STATUS", "CID", "CONFLICT"}
+}
+
+func (r *restoreOutput) rows() [][]string {
+	resolution := "-"
+	if r.Conflict != nil {
+		resolution = r.Conflict.Resolution
+	}
+	return [][]string{{
+		fmt.Sprintf("%.0f%%", r.PercentCompleted),
+		r.File.AbsolutePath,
+		zyncd.FormatSize(r.File.Size),
+		orDash(r.File.Status),
+		orDash(r.File.CID),
+		resolution,
+	}}
+}
+
+func (r *restoreOutput) paths() []string {
+	return r.File.paths()
+}
+
+// restoreStream is implemented by the streams of restore progress
+// returned by the daemon
+type restoreStream interface {
+	Recv() (*zync.RestoreStatusUpdate, error)
+}
+
+// printRestore prints every file received from the stream
+func printRestore(p *printer, rc restoreStream) error {
+	for {
+		update, err := rc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if update.File == nil {
+			continue
+		}
+		err = p.print(&restoreOutput{
+			PercentCompleted: update.PercentCompleted,
+			File:             newFileOutput(update.File),
+			Conflict:         newConflictOutput(update.Conflict),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.flush()
+}
+
+type eventOutput struct {
+	Type         string     `json:"type"`
+	AbsolutePath string     `json:"absolute_path"`
+	OldCID       string     `json:"old_cid"`
+	NewCID       string     `json:"new_cid"`
+	Size         int64      `json:"size"`
+	Duration     string     `json:"duration"`
+	Error        string     `json:"error"`
+	Time         *time.Time `json:"time"`
+}
+
+func newEventOutput(event *zync.Event) *eventOutput {
+	return &eventOutput{
+		Type:         strings.ToLower(strings.TrimPrefix(event.Type.String(), "EVENT_TYPE_")),
+		AbsolutePath: event.AbsolutePath,
+		OldCID:       event.OldCid,
+		NewCID:       event.NewCid,
+		Size:         event.Size,
+		Duration:     event.Duration.AsDuration().String(),
+		Error:        event.Error,
+		Time:         toTime(event.Time),
+	}
+}
+
+func (e *eventOutput) columns() []string {
+	return []string{"TIME", "TYPE", "PATH", "OLD CID", "NEW CID", "ERROR"}
+}
+
+func (e *eventOutput) rows() [][]string {
+	return [][]string{{
+		formatTime(e.Time),
+		e.Type,
+		orDash(e.AbsolutePath),
+		orDash(e.OldCID),
+		orDash(e.NewCID),
+		orDash(e.Error),
+	}}
+}
+
+func (e *eventOutput) paths() []string {
+	if e.AbsolutePath == "" {
+		return nil
+	}
+	return []string{e.AbsolutePath}
+}
+
+type verificationOutput struct {
+	AbsolutePath    string   `json:"absolute_path"`
+	CID             string   `json:"cid"`
+	Checksum        string   `json:"checksum"`
+	Retrievable     bool     `json:"retrievable"`
+	Pinned          bool     `json:"pinned"`
+	ChecksumMatches bool     `json:"checksum_matches"`
+	LocalExists     bool     `json:"local_exists"`
+	LocalDiverged   bool     `json:"local_diverged"`
+	OK              bool     `json:"ok"`
+	Errors          []string `json:"errors"`
+}
+
+func newVerificationOutput(v *zync.Verification) *verificationOutput {
+	errs := v.Errors
+	if errs == nil {
+		errs = []string{}
+	}
+	return &verificationOutput{
+		AbsolutePath:    v.AbsolutePath,
+		CID:             v.Cid,
+		Checksum:        v.Checksum,
+		Retrievable:     v.Retrievable,
+		Pinned:          v.Pinned,
+		ChecksumMatches: v.ChecksumMatches,
+		LocalExists:     v.LocalExists,
+		LocalDiverged:   v.LocalDiverged,
+		OK:              v.Ok,
+		Errors:          errs,
+	}
+}
+
+func (v *verificationOutput) columns() []string {
+	return []string{"PATH", "OK", "RETRIEVABLE", "PINNED", "CHECKSUM", "LOCAL", "ERRORS"}
+}
+
+func (v *verificationOutput) rows() [][]string {
+	checksum := "mismatch"
+	if v.ChecksumMatches {
+		checksum = "match"
+	}
+	local := "unchanged"
+	if !v.LocalExists {
+		local = "missing"
+	} else if v.LocalDiverged {
+		local = "diverged"
+	}
+	return [][]string{{
+		v.AbsolutePath,
+		fmt.Sprint(v.OK),
+		fmt.Sprint(v.Retrievable),
+		fmt.Sprint(v.Pinned),
+		checksum,
+		local,
+		orDash(strings.Join(v.Errors, "; ")),
+	}}
+}
+
+func (v *verificationOutput) paths() []string {
+	return []string{v.AbsolutePath}
+}
+
+type fileErrorOutput struct {
+	AbsolutePath string     `json:"absolute_path"`
+	Error        string     `json:"error"`
+	Time         *time.Time `json:"time"`
+	Attempts     int32      `json:"attempts"`
+}
+
+type statusOutput struct {
+	Uptime           string             `json:"uptime"`
+	Backend          string             `json:"backend"`
+	BackendReachable bool               `json:"backend_reachable"`
+	ManifestCID      string             `json:"manifest_cid"`
+	FileCount        int64              `json:"file_count"`
+	TotalSize        int64              `json:"total_size"`
+	PendingUploads   int64              `json:"pending_uploads"`
+	QueuedRetries    int64              `json:"queued_retries"`
+	LastCommit       *time.Time         `json:"last_commit"`
+	Errors           []*fileErrorOutput `json:"errors"`
+}
+
+func newStatusOutput(status *zync.DaemonStatus) *statusOutput {
+	s := &statusOutput{
+		Uptime:           status.Uptime.AsDuration().Round(time.Second).String(),
+		Backend:          status.Backend,
+		BackendReachable: status.BackendReachable,
+		ManifestCID:      status.ManifestCid,
+		FileCount:        status.FileCount,
+		TotalSize:        status.TotalSize,
+		PendingUploads:   status.PendingUploads,
+		QueuedRetries:    status.QueuedRetries,
+		LastCommit:       toTime(status.LastCommit),
+		Errors:           []*fileErrorOutput{},
+	}
+	for _, fileErr := range status.Errors {
+		s.Errors = append(s.Errors, &fileErrorOutput{
+			AbsolutePath: fileErr.AbsolutePath,
+			Error:        fileErr.Error,
+			Time:         toTime(fileErr.Time),
+			Attempts:     fileErr.Attempts,
+		})
+	}
+	return s
+}
+
+func (s *statusOutput) columns() []string {
+	return nil
+}
+
+func (s *statusOutput) rows() [][]string {
+	reachable := "reachable"
+	if !s.BackendReachable {
+		reachable = "unreachable"
+	}
+	lastCommit := "never"
+	if s.LastCommit != nil {
+		lastCommit = formatTime(s.LastCommit)
+	}
+	rows := [][]string{
+		{"uptime:", s.Uptime},
+		{"backend:", fmt.Sprintf("%s (%s)", s.Backend, reachable)},
+		{"manifest:", orDash(s.ManifestCID)},
+		{"files:", fmt.Sprintf("%d (%s)", s.FileCount, zyncd.FormatSize(s.TotalSize))},
+		{"pending uploads:", fmt.Sprint(s.PendingUploads)},
+		{"queued retries:", fmt.Sprint(s.QueuedRetries)},
+		{"last commit:", lastCommit},
+	}
+	for i, fileErr := range s.Errors {
+		label := ""
+		if i == 0 {
+			label = "errors:"
+		}
+		rows = append(rows, []string{
+			label,
+			fmt.Sprintf(
+				"%s: %s (%d attempts, last at %s)",
+				fileErr.AbsolutePath,
+				fileErr.Error,
+				fileErr.Attempts,
+				formatTime(fileErr.Time),
+			),
+		})
+	}
+	return rows
+}
+
+func (s *statusOutput) paths() []string {
+	paths := make([]string, 0, len(s.Errors))
+	for _, fileErr := range s.Errors {
+		paths = append(paths, fileErr.AbsolutePath)
+	}
+	return paths
+}
+
+type snapshotOutput struct {
+	CID     string     `json:"cid"`
+	Label   string     `json:"label"`
+	TakenAt *time.Time `json:"taken_at"`
+	Files   int64      `json:"files"`
+	Size    int64      `json:"size"`
+}
+
+func newSnapshotOutput(snapshot *zync.Snapshot) *snapshotOutput {
+	return &snapshotOutput{
+		CID:     snapshot.Cid,
+		Label:   snapshot.Label,
+		TakenAt: toTime(snapshot.TakenAt),
+		Files:   snapshot.Files,
+		Size:    snapshot.Size,
+	}
+}
+
+func (s *snapshotOutput) columns() []string {
+	return []string{"CID", "LABEL", "TAKEN", "FILES"}
+}
+
+func (s *snapshotOutput) rows() [][]string {
+	return [][]string{{
+		s.CID,
+		s.Label,
+		formatTime(s.TakenAt),
+		strconv.FormatInt(s.Files, 10),
+	}}
+}
+
+func (s *snapshotOutput) paths() []string {
+	return []string{s.CID}
+}
+
+type tagOutput struct {
+	Name     string     `json:"name"`
+	CID      string     `json:"cid"`
+	TaggedAt *time.Time `json:"tagged_at"`
+}
+
+func newTagOutput(tag *zync.Tag) *tagOutput {
+	return &tagOutput{
+		Name:     tag.Name,
+		CID:      tag.Cid,
+		TaggedAt: toTime(tag.TaggedAt),
+	}
+}
+
+func (t *tagOutput) columns() []string {
+	return []string{"TAG", "CID", "TAGGED"}
+}
+
+func (t *tagOutput) rows() [][]string {
+	return [][]string{{
+		t.Name,
+		t.CID,
+		formatTime(t.TaggedAt),
+	}}
+}
+
+func (t *tagOutput) paths() []string {
+	return []string{t.Name}
+}
+
+type importOutput struct {
+	CID     string `json:"cid"`
+	Files   int64  `json:"files"`
+	Skipped int64  `json:"skipped"`
+}
+
+func (i *importOutput) columns() []string {
+	return []string{"CID", "FILES", "SKIPPED"}
+}
+
+func (i *importOutput) rows() [][]string {
+	return [][]string{{
+		i.CID,
+		strconv.FormatInt(i.Files, 10),
+		strconv.FormatInt(i.Skipped, 10),
+	}}
+}
+
+func (i *importOutput) paths() []string {
+	return []string{i.CID}
+}
+
+type reloadOutput struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requires_restart"`
+}
+
+func newReloadOutput(status *zync.ReloadStatus) *reloadOutput {
+	r := &reloadOutput{
+		Applied:         status.Applied,
+		RequiresRestart: status.RequiresRestart,
+	}
+	if r.Applied == nil {
+		r.Applied = []string{}
+	}
+	if r.RequiresRestart == nil {
+		r.RequiresRestart = []string{}
+	}
+	return r
+}
+
+func (r *reloadOutput) columns() []string {
+	return nil
+}
+
+func (r *reloadOutput) rows() [][]string {
+	if len(r.Applied) == 0 && len(r.RequiresRestart) == 0 {
+		return [][]string{{"no changes"}}
+	}
+	var rows [][]string
+	for _, change := range r.Applied {
+		rows = append(rows, []string{"applied:", change})
+	}
+	for _, change := range r.RequiresRestart {
+		rows = append(rows, []string{"requires restart:", change})
+	}
+	return rows
+}
+
+func (r *reloadOutput) paths() []string {
+	return nil
+}
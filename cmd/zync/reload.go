@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) reloadCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reload",
+		Short: "Reloads the configuration of the daemon, reporting the changes applied",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := c.reload(); err != nil {
+				fmt.Fprintf(os.Stderr, "error reloading configuration: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func (c *client) reload() error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	status, err := c.cc.Reload(context.TODO(), &zync.ReloadRequest{})
+	if err != nil {
+		return err
+	}
+
+	if err := p.print(newReloadOutput(status)); err != nil {
+		return err
+	}
+	return p.flush()
+}
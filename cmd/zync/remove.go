@@ -1,20 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/dnjp/zync/proto/zync/v1"
 	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/proto"
 )
 
 func (c *client) removeFilesCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "rm PATTERN",
-		Short: "Remove files matching the given pattern stored in ipfs - not on the host",
-		Args:  validRegexArg,
+	var patterns patternFlags
+	var all, yes bool
+	var max int64
+	cmd := &cobra.Command{
+		Use:   "rm PATTERN...",
+		Short: "Remove files matching the given patterns stored in ipfs - not on the host",
+		Long: `Remove files matching the given patterns stored in ipfs - not on the host.
+
+The files that would be removed are listed first, and only removed once
+confirmed. Removed files can be brought back with zync undo.`,
+		Args: patterns.validArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := c.connect(); err != nil {
 				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
@@ -27,35 +37,180 @@ func (c *client) removeFilesCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
-			pattern := args[0]
-			if err := c.rm(cwd, pattern); err != nil {
+			req := &zync.RegexRequest{
+				CurrentDirectory: cwd,
+				PatternType:      patterns.patternType(),
+				All:              all,
+				MaxFiles:         max,
+			}
+			if yes {
+				err = c.rm(req, args)
+			} else {
+				err = c.confirmRm(req, args)
+			}
+			if err != nil {
 				fmt.Fprintf(os.Stderr, "error removing files: %+v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
+	patterns.register(cmd)
+	cmd.Flags().BoolVar(&all, "all", false, "remove matching files anywhere, rather than only within the current directory")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "remove matching files without asking for confirmation")
+	cmd.Flags().Int64Var(&max, "max", 0, "refuse to remove anything when more than this many files match (default is no limit)")
+	return cmd
 }
 
-func (c *client) rm(cwd, pattern string) error {
+// rm removes the files matching any of the patterns, printing them
+func (c *client) rm(req *zync.RegexRequest, patterns []string) error {
+	paths, err := c.matching(req, patterns, nil)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "no files match")
+		return nil
+	}
 
-	fc, err := c.cc.DeleteFiles(context.TODO(), &zync.RegexRequest{
-		Pattern:          pattern,
-		CurrentDirectory: cwd,
-	})
+	p, err := c.printer(outputTable)
 	if err != nil {
 		return err
 	}
+	if _, err := c.remove(req, paths, p); err != nil {
+		return err
+	}
+	return p.flush()
+}
 
-	for {
-		file, err := fc.Recv()
+// confirmRm prints the files matching any of the patterns and removes
+// them once confirmed. Exactly the printed files are removed, so files
+// that appear in the meantime are never removed
+func (c *client) confirmRm(req *zync.RegexRequest, patterns []string) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	paths, err := c.matching(req, patterns, p)
+	if err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		fmt.Fprintln(os.Stderr, "no files match")
+		return nil
+	}
+
+	ok, err := confirm(fmt.Sprintf("remove %s from zync? they are kept on disk", files(len(paths))))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "nothing was removed")
+		return nil
+	}
+
+	removed, err := c.remove(req, paths, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "removed %s, run zync undo to bring them back\n", files(removed))
+	return nil
+}
+
+// matching returns the paths of the files matching any of the
+// patterns without removing them, printing each file once when p is set
+func (c *client) matching(req *zync.RegexRequest, patterns []string, p *printer) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		preview := proto.Clone(req).(*zync.RegexRequest)
+		preview.Pattern = pattern
+		preview.DryRun = true
+		fc, err := c.cc.DeleteFiles(context.TODO(), preview)
 		if err != nil {
+			return nil, err
+		}
+		for {
+			file, err := fc.Recv()
 			if err == io.EOF {
 				break
+			} else if err != nil {
+				return nil, err
+			}
+			if seen[file.AbsolutePath] {
+				continue
+			}
+			seen[file.AbsolutePath] = true
+			paths = append(paths, file.AbsolutePath)
+			if p == nil {
+				continue
+			}
+			if err := p.print(newFileOutput(file)); err != nil {
+				return nil, err
 			}
-			return err
 		}
-		fmt.Fprintf(os.Stdout, "file: %+v\n", file)
 	}
+	return paths, nil
+}
 
-	return nil
+// remove removes exactly the files at paths in a single request, so
+// that zync undo brings all of them back, printing them when p is set.
+// It returns how many files were removed
+func (c *client) remove(req *zync.RegexRequest, paths []string, p *printer) (int, error) {
+	remove := proto.Clone(req).(*zync.RegexRequest)
+	remove.Pattern = ""
+	remove.Paths = paths
+	remove.MaxFiles = int64(len(paths))
+	fc, err := c.cc.DeleteFiles(context.TODO(), remove)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for {
+		file, err := fc.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return removed, err
+		}
+		removed++
+		if p == nil {
+			continue
+		}
+		if err := p.print(newFileOutput(file)); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// confirm asks the question on the terminal, returning whether it was
+// answered with yes
+func confirm(question string) (bool, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("cannot ask for confirmation without a terminal, pass --yes to confirm")
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func files(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
 }
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/dnjp/zync/proto/zync/v1"
@@ -11,42 +10,39 @@ import (
 )
 
 func (c *client) restoreCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "restore CID",
+	var policy string
+	cmd := &cobra.Command{
+		Use:   "restore CID|TAG|NAME",
 		Args:  cobra.MinimumNArgs(1),
-		Short: "Initiates a full restore from the database held at the given CID",
+		Short: "Initiates a full restore from the database held at the given CID, tag or IPNS name",
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := c.connect(); err != nil {
 				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
 				os.Exit(1)
 			}
 
-			if err := c.restore(args[0]); err != nil {
+			if err := c.restore(args[0], policy); err != nil {
 				fmt.Fprintf(os.Stderr, "error during restore: %+v\n", err)
 				os.Exit(1)
 			}
 		},
 	}
+	cmd.Flags().StringVar(&policy, "conflict", "", "how to resolve files that differ locally: prefer-local, prefer-remote, keep-both or ask (default is the daemon's conflict_policy)")
+	return cmd
 }
 
-func (c *client) restore(cid string) error {
-	rc, err := c.cc.Restore(context.TODO(), &zync.RestoreRequest{
-		Cid: cid,
-	})
+func (c *client) restore(cid, policy string) error {
+	p, err := c.printer(outputTable)
 	if err != nil {
 		return err
 	}
 
-	for {
-		update, err := rc.Recv()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-		fmt.Fprintf(os.Stdout, "update %+v\n", update)
+	rc, err := c.cc.Restore(context.TODO(), &zync.RestoreRequest{
+		Cid:            cid,
+		ConflictPolicy: policy,
+	})
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return printRestore(p, rc)
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) snapshotsCmd() *cobra.Command {
+	var label string
+	cmd := &cobra.Command{
+		Use:   "snapshots",
+		Short: "Lists the retained snapshots taken by backup or on a schedule, newest first",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := c.snapshots(label); err != nil {
+				fmt.Fprintf(os.Stderr, "error listing snapshots: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&label, "label", "", "only list the snapshots with this label")
+	return cmd
+}
+
+func (c *client) snapshots(label string) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	sc, err := c.cc.ListSnapshots(context.TODO(), &zync.ListSnapshotsRequest{
+		Label: label,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		snapshot, err := sc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := p.print(newSnapshotOutput(snapshot)); err != nil {
+			return err
+		}
+	}
+
+	return p.flush()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) statusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Reports the health of the daemon and the state of the files it manages",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := c.status(); err != nil {
+				fmt.Fprintf(os.Stderr, "error retrieving status: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func (c *client) status() error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	status, err := c.cc.Status(context.TODO(), &zync.StatusRequest{})
+	if err != nil {
+		return err
+	}
+
+	if err := p.print(newStatusOutput(status)); err != nil {
+		return err
+	}
+	return p.flush()
+}
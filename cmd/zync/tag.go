@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) tagCmd() *cobra.Command {
+	var remove, force bool
+	cmd := &cobra.Command{
+		Use:   "tag [NAME [CID|TAG|NAME]]",
+		Args:  cobra.MaximumNArgs(2),
+		Short: "Names a snapshot, by default the latest backup, or lists the tags when no name is given",
+		Long: `Names a snapshot, by default the latest backup, or lists the tags when no name is given.
+
+A tag can be given anywhere a CID is accepted, such as zync restore and
+zync export. Tagged snapshots are kept until the tag is removed, whatever
+the retention of their label.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if remove && len(args) != 1 {
+				fmt.Fprintf(os.Stderr, "--delete takes exactly one tag\n")
+				os.Exit(1)
+			}
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+
+			var err error
+			switch {
+			case len(args) == 0:
+				err = c.tags()
+			case remove:
+				err = c.untag(args[0])
+			default:
+				var cid string
+				if len(args) > 1 {
+					cid = args[1]
+				}
+				err = c.tag(args[0], cid, force)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error tagging: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&remove, "delete", "d", false, "remove the tag, releasing its snapshot")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "move the tag if it already names another snapshot")
+	return cmd
+}
+
+func (c *client) tag(name, cid string, force bool) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	tag, err := c.cc.AddTag(context.TODO(), &zync.AddTagRequest{
+		Name:  name,
+		Cid:   cid,
+		Force: force,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := p.print(newTagOutput(tag)); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+func (c *client) untag(name string) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	tag, err := c.cc.RemoveTag(context.TODO(), &zync.RemoveTagRequest{
+		Name: name,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := p.print(newTagOutput(tag)); err != nil {
+		return err
+	}
+	return p.flush()
+}
+
+func (c *client) tags() error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	tc, err := c.cc.ListTags(context.TODO(), &zync.ListTagsRequest{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		tag, err := tc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := p.print(newTagOutput(tag)); err != nil {
+			return err
+		}
+	}
+
+	return p.flush()
+}
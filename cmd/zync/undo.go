@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) undoCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "undo [CID|TAG|NAME]",
+		Args:  cobra.MaximumNArgs(1),
+		Short: "Brings back the files removed since the given snapshot, by default undoing the last removal",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+
+			var cid string
+			if len(args) > 0 {
+				cid = args[0]
+			}
+			if err := c.undo(cid); err != nil {
+				fmt.Fprintf(os.Stderr, "error during undo: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func (c *client) undo(cid string) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+
+	uc, err := c.cc.Undo(context.TODO(), &zync.UndoRequest{
+		Cid: cid,
+	})
+	if err != nil {
+		return err
+	}
+	return printRestore(p, uc)
+}
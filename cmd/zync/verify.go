@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) verifyCmd() *cobra.Command {
+	var patterns patternFlags
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "verify [pattern]",
+		Short: "Checks that files matching the given pattern can be restored, printing a report per file",
+		Args:  cobra.MatchAll(cobra.MaximumNArgs(1), patterns.validArgs(0)),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+
+			cwd, err := os.Getwd()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read file: %+v\n", err)
+				os.Exit(1)
+			}
+
+			var pattern string
+			if len(args) > 0 {
+				pattern = args[0]
+			}
+
+			ok, err := c.verify(&zync.RegexRequest{
+				Pattern:          pattern,
+				CurrentDirectory: cwd,
+				PatternType:      patterns.patternType(),
+				All:              all,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error verifying files: %+v\n", err)
+				os.Exit(1)
+			}
+			if !ok {
+				os.Exit(2)
+			}
+		},
+	}
+	patterns.register(cmd)
+	cmd.Flags().BoolVar(&all, "all", false, "verify matching files anywhere, rather than only within the current directory")
+	return cmd
+}
+
+// verify prints the verification report for every matching file,
+// returning false if any of them cannot be restored
+func (c *client) verify(req *zync.RegexRequest) (bool, error) {
+	p, err := c.printer(outputJSON)
+	if err != nil {
+		return false, err
+	}
+
+	vc, err := c.cc.Verify(context.TODO(), req)
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+	for {
+		verification, err := vc.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return false, err
+		}
+		if err := p.print(newVerificationOutput(verification)); err != nil {
+			return false, err
+		}
+		ok = ok && verification.Ok
+	}
+
+	return ok, p.flush()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/spf13/cobra"
+)
+
+func (c *client) watchCmd() *cobra.Command {
+	var patterns patternFlags
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "watch [pattern]",
+		Short: "Streams activity for files matching the given pattern as it happens",
+		Args:  cobra.MatchAll(cobra.MaximumNArgs(1), patterns.validArgs(0)),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := c.connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to connect to daemon: %+v\n", err)
+				os.Exit(1)
+			}
+
+			cwd, err := os.Getwd()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read file: %+v\n", err)
+				os.Exit(1)
+			}
+
+			var pattern string
+			if len(args) > 0 {
+				pattern = args[0]
+			}
+
+			err = c.watch(&zync.RegexRequest{
+				Pattern:          pattern,
+				CurrentDirectory: cwd,
+				PatternType:      patterns.patternType(),
+				All:              all,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error watching events: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	patterns.register(cmd)
+	cmd.Flags().BoolVar(&all, "all", false, "watch matching files anywhere, rather than only within the current directory")
+	return cmd
+}
+
+func (c *client) watch(req *zync.RegexRequest) error {
+	p, err := c.printer(outputTable)
+	if err != nil {
+		return err
+	}
+	p.streaming()
+
+	ec, err := c.cc.WatchEvents(context.TODO(), req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		event, err := ec.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if err := p.print(newEventOutput(event)); err != nil {
+			return err
+		}
+	}
+
+	return p.flush()
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -11,16 +14,15 @@ import (
 	"github.com/dnjp/zync/watcher"
 	shell "github.com/ipfs/go-ipfs-api"
 	"github.com/sevlyar/go-daemon"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 func newDaemon() *daemon.Context {
 	return &daemon.Context{
-		PidFileName: "zyncd.pid",
+		PidFileName: viper.GetString("pid_file"),
 		PidFilePerm: 0644,
-		LogFileName: "zyncd.log",
-		LogFilePerm: 0640,
 		WorkDir:     "./",
 		Umask:       027,
 		Args:        []string{},
@@ -28,6 +30,9 @@ func newDaemon() *daemon.Context {
 }
 
 func startDaemon(ctx *daemon.Context) (proc *os.Process, shouldExit bool, err error) {
+	if err = os.MkdirAll(filepath.Dir(ctx.PidFileName), 0700); err != nil {
+		return
+	}
 	proc, err = ctx.Reborn()
 	if err != nil {
 		return
@@ -43,6 +48,59 @@ func stopDaemon(ctx *daemon.Context) error {
 	return ctx.Release()
 }
 
+// findDaemon returns the running daemon, or nil if it is not running
+func findDaemon() (*os.Process, error) {
+	pidFile := viper.GetString("pid_file")
+	if _, err := os.Stat(pidFile); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	lock, err := daemon.OpenLockFile(pidFile, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+
+	// the daemon holds a lock on its pid file for as long as it runs, so
+	// a pid file that can be locked was left behind by an exited daemon
+	if err := lock.Lock(); err == nil {
+		lock.Unlock()
+		return nil, nil
+	} else if err != daemon.ErrWouldBlock {
+		return nil, err
+	}
+
+	pid, err := lock.ReadPid()
+	if err != nil {
+		return nil, err
+	}
+	return os.FindProcess(pid)
+}
+
+// stop terminates the running daemon, waiting up to timeout for it to
+// exit. It returns false if the daemon was not running
+func stop(timeout time.Duration) (bool, error) {
+	proc, err := findDaemon()
+	if err != nil || proc == nil {
+		return false, err
+	}
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		return false, err
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		running, err := findDaemon()
+		if err != nil {
+			return true, err
+		}
+		if running == nil {
+			return true, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true, fmt.Errorf("zyncd (pid %d) did not exit within %s", proc.Pid, timeout)
+}
+
 func rootCmd(configFile *string) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:                   "zyncd COMMAND",
@@ -62,77 +120,306 @@ func rootCmd(configFile *string) *cobra.Command {
 
 func initCommands(cmd *cobra.Command) {
 	cmd.AddCommand(startCmd())
+	cmd.AddCommand(stopCmd())
+	cmd.AddCommand(statusCmd())
+	cmd.AddCommand(restartCmd())
+	cmd.AddCommand(installServiceCmd())
+	cmd.AddCommand(uninstallServiceCmd())
 }
 
 func initFlags(cmd *cobra.Command, configFile *string) {
 	cmd.PersistentFlags().StringVar(configFile, "config", "./config.yaml", "config file (default is ./config.yaml)")
 }
 
+// loadConfig reads the config file, returning the configuration of the
+// daemon. It is called again whenever the daemon is reloaded
+func loadConfig() (zyncd.Config, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return zyncd.Config{}, err
+	}
+
+	projectID := viper.GetString("PROJECT_ID")
+	projectSecret := viper.GetString("PROJECT_SECRET")
+	ipfsHost := viper.GetString("ipfs_host")
+	useEnv := viper.GetBool("use_ipfs_env")
+
+	var sh *shell.Shell
+	if projectID != "" && projectSecret != "" && useEnv {
+		// configure ipfs client for Infura: https://infura.io
+		sh = shell.NewShellWithClient(
+			ipfsHost,
+			watcher.NewIPFSClient(projectID, projectSecret),
+		)
+	} else {
+		sh = shell.NewShell(ipfsHost)
+	}
+
+	policy, err := watcher.ParseConflictPolicy(viper.GetString("conflict_policy"))
+	if err != nil {
+		return zyncd.Config{}, err
+	}
+
+	var addresses []string
+	if socket := viper.GetString("socket"); socket != "" {
+		addresses = append(addresses, "unix://"+socket)
+	}
+	if port := viper.GetInt("port"); port != 0 {
+		addresses = append(addresses, net.JoinHostPort(viper.GetString("host"), strconv.Itoa(port)))
+	}
+	if len(addresses) == 0 {
+		return zyncd.Config{}, fmt.Errorf("either socket or port must be configured")
+	}
+
+	security := zyncd.Security{
+		CertFile:     viper.GetString("tls_cert"),
+		KeyFile:      viper.GetString("tls_key"),
+		ClientCAFile: viper.GetString("tls_client_ca"),
+		Token:        viper.GetString("auth_token"),
+	}
+	if security.TLSEnabled() {
+		if _, err := security.TLSConfig(); err != nil {
+			return zyncd.Config{}, fmt.Errorf("invalid tls configuration: %w", err)
+		}
+	} else if security.CertFile != "" || security.KeyFile != "" || security.ClientCAFile != "" {
+		return zyncd.Config{}, fmt.Errorf("tls requires both tls_cert and tls_key")
+	}
+
+	var names watcher.Names
+	if key := viper.GetString("ipns_key"); key != "" {
+		names = watcher.NewIPNS(sh, key)
+	}
+	// announcements are only sent for a published name, and only
+	// received for followed names
+	if viper.GetString("pubsub_topic") != "" && names == nil && len(viper.GetStringSlice("follow")) == 0 {
+		return zyncd.Config{}, fmt.Errorf("pubsub_topic requires ipns_key to announce manifests or follow to receive them")
+	}
+
+	schedules, err := loadSchedules()
+	if err != nil {
+		return zyncd.Config{}, err
+	}
+
+	return zyncd.Config{
+		Addresses: addresses,
+		Shell:     sh,
+		Settings: watcher.Settings{
+			BackupLocation:  viper.GetString("cid_cache"),
+			RefreshInterval: time.Duration(viper.GetInt("refresh_seconds")) * time.Second,
+			ConflictPolicy:  policy,
+			Backend:         ipfsHost,
+			Follow:          viper.GetStringSlice("follow"),
+			FollowInterval:  time.Duration(viper.GetInt("follow_seconds")) * time.Second,
+			DeleteRemoved:   viper.GetBool("delete_removed"),
+			Names:           names,
+			Broker:          watcher.NewPubSub(sh),
+			Topic:           viper.GetString("pubsub_topic"),
+			Schedules:       schedules,
+		},
+		Security:       security,
+		MetricsAddress: viper.GetString("metrics_address"),
+		BrowserAddress: viper.GetString("browser_address"),
+		GatewayAddress: viper.GetString("gateway_address"),
+	}, nil
+}
+
+// loadSchedules reads the snapshots taken on a schedule and their
+// retention
+func loadSchedules() ([]watcher.Schedule, error) {
+	var entries []struct {
+		Label      string `mapstructure:"label"`
+		Schedule   string `mapstructure:"schedule"`
+		Keep       int    `mapstructure:"keep"`
+		MaxAgeDays int    `mapstructure:"max_age_days"`
+	}
+	if err := viper.UnmarshalKey("snapshots", &entries); err != nil {
+		return nil, fmt.Errorf("invalid snapshots: %w", err)
+	}
+
+	labels := make(map[string]bool)
+	schedules := make([]watcher.Schedule, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Label == "" {
+			return nil, fmt.Errorf("every snapshot schedule must have a label")
+		}
+		if labels[entry.Label] {
+			return nil, fmt.Errorf("snapshot label %q is used by more than one schedule", entry.Label)
+		}
+		labels[entry.Label] = true
+		if entry.Keep < 0 || entry.MaxAgeDays < 0 {
+			return nil, fmt.Errorf("snapshots labeled %q cannot keep a negative number or age", entry.Label)
+		}
+
+		schedule := watcher.Schedule{
+			Label:  entry.Label,
+			Keep:   entry.Keep,
+			MaxAge: time.Duration(entry.MaxAgeDays) * 24 * time.Hour,
+		}
+		if entry.Schedule != "" {
+			cron, err := watcher.ParseCron(entry.Schedule)
+			if err != nil {
+				return nil, err
+			}
+			schedule.Cron = cron
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
 func startCmd() *cobra.Command {
-	return &cobra.Command{
+	var foreground bool
+	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "Launches the daemon",
 		Run: func(cmd *cobra.Command, args []string) {
+			start(foreground)
+		},
+	}
+	cmd.Flags().BoolVar(&foreground, "foreground", false, "run in the foreground, logging to stderr, for use under a service manager")
+	return cmd
+}
 
-			projectID := viper.GetString("PROJECT_ID")
-			projectSecret := viper.GetString("PROJECT_SECRET")
-			ipfsHost := viper.GetString("ipfs_host")
-			useEnv := viper.GetBool("use_ipfs_env")
-
-			var sh *shell.Shell
-			if projectID != "" && projectID != "" && useEnv {
-				// configure ipfs client for Infura: https://infura.io
-				sh = shell.NewShellWithClient(
-					ipfsHost,
-					watcher.NewIPFSClient(projectID, projectSecret),
-				)
-			} else {
-				sh = shell.NewShell(ipfsHost)
+func stopCmd() *cobra.Command {
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stops the running daemon",
+		Run: func(cmd *cobra.Command, args []string) {
+			stopped, err := stop(timeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to stop daemon: %+v\n", err)
+				os.Exit(1)
 			}
+			if !stopped {
+				fmt.Fprintln(os.Stdout, "zyncd is not running")
+				return
+			}
+			fmt.Fprintln(os.Stdout, "zyncd stopped")
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "how long to wait for the daemon to exit")
+	return cmd
+}
 
-			server, err := zyncd.NewServer(
-				8081,
-				sh,
-				viper.GetString("cid_cache"),
-				time.Duration(viper.GetInt("refresh_seconds"))*time.Second,
-			)
+func statusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Reports whether the daemon is running, exiting with status 3 if it is not",
+		Run: func(cmd *cobra.Command, args []string) {
+			proc, err := findDaemon()
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "%+v\n", err)
+				fmt.Fprintf(os.Stderr, "failed to find daemon: %+v\n", err)
 				os.Exit(1)
 			}
+			if proc == nil {
+				fmt.Fprintln(os.Stdout, "zyncd is not running")
+				os.Exit(3)
+			}
+			fmt.Fprintf(os.Stdout, "zyncd is running (pid %d)\n", proc.Pid)
+			fmt.Fprintf(os.Stdout, "pid file: %s\n", viper.GetString("pid_file"))
+			fmt.Fprintf(os.Stdout, "log file: %s\n", logDestination(false))
+		},
+	}
+}
+
+func restartCmd() *cobra.Command {
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "Stops the running daemon, if any, and launches it again",
+		Run: func(cmd *cobra.Command, args []string) {
+			// the daemon is started by re-executing this command, so only
+			// the original process stops the previous daemon
+			if !daemon.WasReborn() {
+				if _, err := stop(timeout); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to stop daemon: %+v\n", err)
+					os.Exit(1)
+				}
+			}
+			start(false)
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "how long to wait for the daemon to exit")
+	return cmd
+}
 
-			daemon.SetSigHandler(
-				server.HandleTerminate,
-				syscall.SIGQUIT,
-				syscall.SIGTERM,
-			)
+// start runs the daemon, detaching from the terminal unless foreground
+// is set
+func start(foreground bool) {
 
-			ctx := newDaemon()
+	// report configuration errors before detaching
+	if _, err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+	if err := validateLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
 
-			_, shouldExit, err := startDaemon(ctx)
-			if err != nil {
-				log.Fatalf("failed to start daemon: %+v\n", err)
-			}
-			if shouldExit {
-				return
-			}
+	if foreground {
+		// hold the pid file like the detached daemon does, so that only
+		// one daemon runs and stop and status can find it
+		pidFile := viper.GetString("pid_file")
+		if err := os.MkdirAll(filepath.Dir(pidFile), 0700); err != nil {
+			log.WithError(err).Fatal("failed to create pid file")
+		}
+		lock, err := daemon.CreatePidFile(pidFile, 0644)
+		if err != nil {
+			log.WithError(err).Fatal("failed to create pid file")
+		}
+		defer lock.Remove()
+	} else {
+		ctx := newDaemon()
 
-			defer stopDaemon(ctx)
+		_, shouldExit, err := startDaemon(ctx)
+		if err != nil {
+			log.WithError(err).Fatal("failed to start daemon")
+		}
+		if shouldExit {
+			return
+		}
 
-			log.Print("- - - - - - - - - - - - - - -")
-			log.Print("        zyncd started")
-			log.Print("- - - - - - - - - - - - - - -")
+		defer stopDaemon(ctx)
+	}
 
-			errs := make(chan error)
-			go func() { errs <- server.Start() }()
-			go func() { errs <- daemon.ServeSignals() }()
+	if err := configureLogging(foreground); err != nil {
+		log.WithError(err).Fatal("failed to configure logging")
+	}
 
-			err = <-errs
-			if err != nil {
-				log.Fatalf("error encountered: %+v\n", err)
-			}
+	server, err := zyncd.NewServer(func() (zyncd.Config, error) {
+		config, err := loadConfig()
+		if err != nil {
+			return config, err
+		}
+		return config, configureLogging(foreground)
+	})
+	if err != nil {
+		log.WithError(err).Fatal("failed to start server")
+	}
 
-			log.Println("daemon terminated")
-		},
+	daemon.SetSigHandler(
+		server.HandleTerminate,
+		syscall.SIGQUIT,
+		syscall.SIGTERM,
+	)
+	daemon.SetSigHandler(server.HandleReload, syscall.SIGHUP)
+
+	log.WithField("pid", os.Getpid()).Info("zyncd started")
+
+	errs := make(chan error)
+	go func() { errs <- server.Start() }()
+	go func() { errs <- daemon.ServeSignals() }()
+
+	// the listeners are open, so tell systemd that clients can connect
+	if err := zyncd.Notify("READY=1"); err != nil {
+		log.WithError(err).Warn("could not notify service manager")
+	}
+
+	err = <-errs
+	if err != nil {
+		log.WithError(err).Fatal("error encountered")
 	}
+
+	log.Info("daemon terminated")
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// rotating is the log file currently written to, if any, which is closed
+// when the logging configuration changes
+var rotating *lumberjack.Logger
+
+// logDestination returns where the daemon logs: a file path, stderr or
+// stdout. A daemon in the foreground logs to stderr unless log_file is
+// set in the config file
+func logDestination(foreground bool) string {
+	if foreground && !viper.InConfig("log_file") {
+		return "stderr"
+	}
+	return viper.GetString("log_file")
+}
+
+// logFormatter returns the formatter for the configured log_format
+func logFormatter() (log.Formatter, error) {
+	switch format := viper.GetString("log_format"); format {
+	case "text":
+		return &log.TextFormatter{FullTimestamp: true}, nil
+	case "json":
+		return &log.JSONFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("invalid log_format %q, must be text or json", format)
+	}
+}
+
+// validateLogging reports errors in the logging configuration without
+// applying it
+func validateLogging() error {
+	if _, err := log.ParseLevel(viper.GetString("log_level")); err != nil {
+		return err
+	}
+	_, err := logFormatter()
+	return err
+}
+
+// configureLogging applies the logging configuration. It is called again
+// whenever the daemon is reloaded
+func configureLogging(foreground bool) error {
+	level, err := log.ParseLevel(viper.GetString("log_level"))
+	if err != nil {
+		return err
+	}
+	formatter, err := logFormatter()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer
+	var file *lumberjack.Logger
+	switch dest := logDestination(foreground); dest {
+	case "stderr":
+		out = os.Stderr
+	case "stdout":
+		out = os.Stdout
+	default:
+		if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			return err
+		}
+		file = &lumberjack.Logger{
+			Filename:   dest,
+			MaxSize:    viper.GetInt("log_max_size_mb"),
+			MaxBackups: viper.GetInt("log_max_backups"),
+			MaxAge:     viper.GetInt("log_max_age_days"),
+		}
+		out = file
+	}
+
+	log.SetLevel(level)
+	log.SetFormatter(formatter)
+	log.SetOutput(out)
+	if rotating != nil {
+		rotating.Close()
+	}
+	rotating = file
+	return nil
+}
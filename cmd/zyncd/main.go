@@ -2,20 +2,39 @@ package main
 
 import (
 	"fmt"
-	"github.com/spf13/viper"
 	"os"
+
+	zyncd "github.com/dnjp/zync/daemon"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func main() {
 	var configFile string
 	cmd := rootCmd(&configFile)
 
-	viper.SetConfigFile(configFile)
+	viper.SetDefault("conflict_policy", "prefer-local")
+	viper.SetDefault("follow_seconds", 60)
+	viper.SetDefault("socket", zyncd.DefaultSocket())
+	viper.SetDefault("port", 0)
+	viper.SetDefault("host", "localhost")
+	viper.SetDefault("pid_file", zyncd.DefaultPidFile())
+	viper.SetDefault("log_file", zyncd.DefaultLogFile())
+	viper.SetDefault("log_level", "info")
+	viper.SetDefault("log_format", "text")
+	viper.SetDefault("log_max_size_mb", 100)
+	viper.SetDefault("log_max_backups", 5)
+	viper.SetDefault("log_max_age_days", 30)
 	viper.AutomaticEnv()
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Fprint(os.Stderr, err)
-		os.Exit(1)
-	}
+
+	// the config file is only known once the flags have been parsed
+	cobra.OnInitialize(func() {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			fmt.Fprint(os.Stderr, err)
+			os.Exit(1)
+		}
+	})
 
 	err := cmd.Execute()
 	if err != nil {
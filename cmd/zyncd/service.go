@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const serviceName = "zyncd.service"
+
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=Zync daemon keeping files backed up to IPFS
+Documentation=https://github.com/dnjp/zync
+After=network-online.target
+
+[Service]
+Type=notify
+WorkingDirectory={{ .WorkingDirectory }}
+ExecStart={{ .Executable }} --config {{ .Config }} start --foreground
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`))
+
+// unitFile returns the path of the systemd user unit for the daemon
+func unitFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "systemd", "user", serviceName), nil
+}
+
+// unit renders the systemd user unit that runs this executable with the
+// config file in use
+func unit() ([]byte, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return nil, err
+	}
+	config, err := filepath.Abs(viper.ConfigFileUsed())
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	err = unitTemplate.Execute(&b, struct {
+		Executable       string
+		Config           string
+		WorkingDirectory string
+	}{
+		Executable: strconv.Quote(executable),
+		Config:     strconv.Quote(config),
+		// relative paths within the config file are relative to it
+		WorkingDirectory: filepath.Dir(config),
+	})
+	return b.Bytes(), err
+}
+
+// systemctl runs systemctl against the user's service manager
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", append([]string{"--user"}, args...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func installServiceCmd() *cobra.Command {
+	var noEnable bool
+	cmd := &cobra.Command{
+		Use:   "install-service",
+		Short: "Writes a systemd user unit that runs the daemon with this config file, then enables and starts it",
+		Run: func(cmd *cobra.Command, args []string) {
+			file, err := unitFile()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to locate unit file: %+v\n", err)
+				os.Exit(1)
+			}
+			b, err := unit()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to create unit: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to create unit: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(file, b, 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to create unit: %+v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stdout, "wrote %s\n", file)
+
+			if noEnable {
+				return
+			}
+			if _, err := exec.LookPath("systemctl"); err != nil {
+				fmt.Fprintf(os.Stderr, "systemctl not found, enable the service with: systemctl --user enable --now %s\n", serviceName)
+				os.Exit(1)
+			}
+			if err := systemctl("daemon-reload"); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to reload systemd: %+v\n", err)
+				os.Exit(1)
+			}
+			if err := systemctl("enable", "--now", serviceName); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to enable service: %+v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&noEnable, "no-enable", false, "only write the unit, without enabling or starting it")
+	return cmd
+}
+
+func uninstallServiceCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "uninstall-service",
+		Short: "Stops and disables the systemd user unit, then removes it",
+		Run: func(cmd *cobra.Command, args []string) {
+			file, err := unitFile()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to locate unit file: %+v\n", err)
+				os.Exit(1)
+			}
+			if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stdout, "%s is not installed\n", serviceName)
+				return
+			}
+
+			if _, err := exec.LookPath("systemctl"); err == nil {
+				// remove the unit even if systemd cannot be reached
+				if err := systemctl("disable", "--now", serviceName); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to disable service: %+v\n", err)
+				}
+			}
+			if err := os.Remove(file); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to remove unit: %+v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stdout, "removed %s\n", file)
+			if _, err := exec.LookPath("systemctl"); err == nil {
+				if err := systemctl("daemon-reload"); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to reload systemd: %+v\n", err)
+					os.Exit(1)
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package daemon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/dnjp/zync/watcher"
+)
+
+// chunkSize keeps each streamed part of an archive well below the
+// maximum size of a gRPC message
+const chunkSize = 64 * 1024
+
+// chunkWriter sends everything written to it in parts of at most
+// chunkSize bytes
+type chunkWriter func(b []byte) error
+
+func (w chunkWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		if err := w(b[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// Export writes the snapshot held at a manifest CID as a
+// tar or CAR archive, streamed in chunks
+func (s *Server) Export(req *zync.ExportRequest, es zync.Zync_ExportServer) error {
+
+	if req.Cid == "" {
+		return fmt.Errorf("must provide cid")
+	}
+
+	format, err := watcher.ParseArchiveFormat(req.Format)
+	if err != nil {
+		return err
+	}
+
+	cid, err := s.store.ResolveManifest(es.Context(), req.Cid)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriterSize(chunkWriter(func(b []byte) error {
+		return es.Send(&zync.ArchiveChunk{Data: b})
+	}), chunkSize)
+	if err := s.store.Export(es.Context(), cid, format, w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Import uploads the contents of a tar or CAR archive,
+// streamed in chunks, returning the resulting snapshot
+func (s *Server) Import(is zync.Zync_ImportServer) error {
+
+	req, err := is.Recv()
+	if err == io.EOF {
+		return fmt.Errorf("archive is empty")
+	} else if err != nil {
+		return err
+	}
+
+	var format watcher.ArchiveFormat
+	if req.Format != "" {
+		format, err = watcher.ParseArchiveFormat(req.Format)
+		if err != nil {
+			return err
+		}
+	}
+	root := req.Root
+	if root == "" {
+		root = "/"
+	}
+
+	r, w := io.Pipe()
+	go func(req *zync.ImportRequest) {
+		for {
+			if _, err := w.Write(req.Data); err != nil {
+				return
+			}
+			var err error
+			if req, err = is.Recv(); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				w.CloseWithError(err)
+				return
+			}
+		}
+	}(req)
+
+	imported, err := s.store.Import(is.Context(), r, format, watcher.FilePath(root))
+	// stop receiving if the archive was not read to the end
+	r.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	return is.SendAndClose(&zync.ImportStatus{
+		Cid:     imported.CID.String(),
+		Files:   int64(imported.Files),
+		Skipped: int64(imported.Skipped),
+	})
+}
@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Security configures how connections made over TCP are protected.
+// Connections made over a Unix socket are already limited to the
+// current user and are never required to authenticate
+type Security struct {
+	// CertFile and KeyFile are the PEM encoded certificate and key the
+	// server presents. TLS is enabled when both are set
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM encoded bundle of the certificate
+	// authorities that sign client certificates. When set, clients must
+	// present a certificate signed by one of them
+	ClientCAFile string
+	// Token is the bearer token clients must present. Tokens are not
+	// required when empty
+	Token string
+}
+
+// TLSEnabled reports whether TCP connections are served over TLS
+func (s Security) TLSEnabled() bool {
+	return s.CertFile != "" && s.KeyFile != ""
+}
+
+// TLSConfig returns the TLS configuration for TCP listeners
+func (s Security) TLSConfig() (*tls.Config, error) {
+	if s.CertFile == "" || s.KeyFile == "" {
+		return nil, fmt.Errorf("both a certificate and key are required for tls")
+	}
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2"},
+	}
+	if s.ClientCAFile != "" {
+		pool, err := LoadCertPool(s.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// LoadCertPool reads the PEM encoded certificates in the file
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// serverOptions returns the interceptors that enforce the token of the
+// current configuration, so that changes to it apply without restarting
+func (s *Server) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.Config().Security.authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.Config().Security.authenticate(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// authenticate checks the bearer token of calls made over TCP
+func (s Security) authenticate(ctx context.Context) error {
+	if s.Token == "" {
+		return nil
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr.Network() == "unix" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing token")
+}
+
+// authorizeHTTP requires requests to present the token returned by
+// token, as a bearer token or as the password of HTTP basic auth, when
+// it is not empty
+func authorizeHTTP(token func() string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := token()
+		if expected == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			presented = password
+		}
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="zyncd"`)
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Token provides a bearer token to every call made by a client
+type Token string
+
+// GetRequestMetadata attaches the token to the call
+func (t Token) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity prevents the token from being sent over
+// connections that are not encrypted
+func (t Token) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,264 @@
+package daemon
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// authority is a throwaway certificate authority
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T, name string) *authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &authority{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue signs a certificate for a server at 127.0.0.1, or for a client
+func (a *authority) issue(t *testing.T, server bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.Subject.CommonName = "zyncd"
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeCert writes the certificate and key as PEM files, returning their
+// paths
+func writeCert(t *testing.T, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, path string, b []byte) string {
+	t.Helper()
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serve serves the health service over TCP with the interceptors and
+// TLS configuration of the daemon, returning its address
+func serve(t *testing.T, security Security) string {
+	t.Helper()
+	var config *tls.Config
+	if security.TLSEnabled() {
+		var err error
+		if config, err = security.TLSConfig(); err != nil {
+			t.Fatalf("TLSConfig: %v", err)
+		}
+	}
+	l, err := listenTCP("127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{config: Config{Security: security}}
+	srv := grpc.NewServer(s.serverOptions()...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+	return l.Addr().String()
+}
+
+// check calls the health service, returning the code of the error
+func check(t *testing.T, address string, opts ...grpc.DialOption) codes.Code {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return status.Code(err)
+}
+
+func clientTLS(ca *authority, certs ...tls.Certificate) grpc.DialOption {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: certs}
+	if ca != nil {
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AddCert(ca.cert)
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
+
+// serverSecurity returns the security of a daemon presenting a
+// certificate signed by ca
+func serverSecurity(t *testing.T, ca *authority) Security {
+	certFile, keyFile := writeCert(t, ca.issue(t, true))
+	return Security{CertFile: certFile, KeyFile: keyFile}
+}
+
+func TestTLS(t *testing.T) {
+	ca := newAuthority(t, "zync test ca")
+	address := serve(t, serverSecurity(t, ca))
+
+	if code := check(t, address, clientTLS(ca)); code != codes.OK {
+		t.Fatalf("client trusting the ca: %v, want OK", code)
+	}
+	if code := check(t, address, clientTLS(newAuthority(t, "other ca"))); code != codes.Unavailable {
+		t.Fatalf("client not trusting the ca: %v, want Unavailable", code)
+	}
+	if code := check(t, address, grpc.WithInsecure()); code != codes.Unavailable {
+		t.Fatalf("plaintext client: %v, want Unavailable", code)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newAuthority(t, "zync test ca")
+	security := serverSecurity(t, ca)
+	security.ClientCAFile = writeFile(t, filepath.Join(t.TempDir(), "ca.pem"), ca.pem)
+	address := serve(t, security)
+
+	tests := []struct {
+		name  string
+		certs []tls.Certificate
+		want  codes.Code
+	}{
+		{name: "no client certificate", want: codes.Unavailable},
+		{name: "certificate of another ca", certs: []tls.Certificate{newAuthority(t, "other ca").issue(t, false)}, want: codes.Unavailable},
+		{name: "certificate of the client ca", certs: []tls.Certificate{ca.issue(t, false)}, want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := check(t, address, clientTLS(ca, tt.certs...)); code != tt.want {
+				t.Fatalf("check = %v, want %v", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	ca := newAuthority(t, "zync test ca")
+	security := serverSecurity(t, ca)
+	security.Token = "secret"
+	address := serve(t, security)
+
+	tests := []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{name: "missing token", want: codes.Unauthenticated},
+		{name: "wrong token", token: "guess", want: codes.Unauthenticated},
+		{name: "correct token", token: "secret", want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []grpc.DialOption{clientTLS(ca)}
+			if tt.token != "" {
+				opts = append(opts, grpc.WithPerRPCCredentials(Token(tt.token)))
+			}
+			if code := check(t, address, opts...); code != tt.want {
+				t.Fatalf("check = %v, want %v", code, tt.want)
+			}
+		})
+	}
+}
+
+// TestTokenRequiresTLS shows why validate refuses a token without TLS:
+// clients cannot send it
+func TestTokenRequiresTLS(t *testing.T) {
+	address := serve(t, Security{})
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithPerRPCCredentials(Token("secret")))
+	if err == nil {
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	}
+	if err == nil {
+		t.Fatal("token was sent without TLS")
+	}
+}
@@ -0,0 +1,398 @@
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/dnjp/zync/watcher"
+	log "github.com/sirupsen/logrus"
+)
+
+// current is the snapshot reference that browses the files the daemon
+// is managing right now
+const current = "current"
+
+// versionsPerPage bounds the versions listed at once, as every snapshot
+// searched for them is retrieved from the backend
+const versionsPerPage = 50
+
+var browserTemplate = template.Must(template.New("browser").Funcs(template.FuncMap{
+	"size": FormatSize,
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>zync - {{ .Title }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; }
+td.num { text-align: right; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<p><a href="/snapshots/current/">current</a> | <a href="/snapshots/">history</a></p>
+<h1>{{ .Title }}</h1>
+{{ if .Crumbs }}<p>{{ range $i, $c := .Crumbs }}{{ if $i }} / {{ end }}<a href="{{ $c.URL }}">{{ $c.Name }}</a>{{ end }}</p>{{ end }}
+{{ if .Snapshots }}
+<table>
+<tr><th>Committed</th><th>Files</th><th>Size</th><th>CID</th></tr>
+{{ range .Snapshots }}<tr><td><a href="/snapshots/{{ .CID }}/">{{ time .CommittedAt }}</a></td><td class="num">{{ .Files }}</td><td class="num">{{ size .Size }}</td><td><code>{{ .CID }}</code></td></tr>
+{{ end }}</table>
+{{ else if .Entries }}
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th><th>CID</th><th></th></tr>
+{{ range .Entries }}{{ if .Dir }}<tr><td><a href="{{ .URL }}">{{ .Name }}/</a></td><td class="num">{{ .Files }} files</td><td></td><td></td><td></td></tr>
+{{ else }}<tr><td><a href="{{ .URL }}">{{ .Name }}</a></td><td class="num">{{ size .Size }}</td><td>{{ time .ModTime }}</td><td><code>{{ .CID }}</code></td><td><a href="{{ .URL }}?download=1">download</a> <a href="{{ .Versions }}">versions</a></td></tr>
+{{ end }}{{ end }}</table>
+{{ else if .Versions }}
+<table>
+<tr><th>Modified</th><th>Size</th><th>First snapshot</th><th>CID</th><th></th></tr>
+{{ range .Versions }}<tr><td>{{ time .ModTime }}</td><td class="num">{{ size .Size }}</td><td><a href="/snapshots/{{ .Snapshot.CID }}/">{{ time .Snapshot.CommittedAt }}</a></td><td><code>{{ .CID }}</code></td><td><a href="{{ .URL }}?download=1">download</a></td></tr>
+{{ end }}</table>
+{{ if .Older }}<p><a href="{{ .Older }}">older versions</a></p>{{ end }}
+{{ else }}
+<p>Nothing here yet.</p>
+{{ end }}
+</body>
+</html>
+`))
+
+type crumb struct {
+	Name string
+	URL  string
+}
+
+type entry struct {
+	Name     string
+	URL      string
+	Dir      bool
+	Files    int
+	Size     int64
+	ModTime  time.Time
+	CID      string
+	Versions string
+}
+
+type version struct {
+	watcher.Version
+	URL string
+}
+
+type page struct {
+	Title     string
+	Crumbs    []crumb
+	Snapshots []watcher.Snapshot
+	Entries   []entry
+	Versions  []version
+	// Older links to the next page of versions
+	Older string
+}
+
+// Browser serves a read-only, directory-style view of the current files
+// of a datastore, its snapshot history and the versions of each file
+type Browser struct {
+	store *watcher.Datastore
+	token func() string
+}
+
+// NewBrowser constructs a browser for the datastore. When token returns
+// a non-empty token, requests must present it as a bearer token or as
+// the password of HTTP basic auth
+func NewBrowser(store *watcher.Datastore, token func() string) *Browser {
+	return &Browser{store: store, token: token}
+}
+
+// Handler serves the browser
+func (b *Browser) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, "/snapshots/current/", http.StatusFound)
+	})
+	mux.HandleFunc("/snapshots/", b.snapshots)
+	mux.HandleFunc("/versions/", b.versions)
+	return authorizeHTTP(b.token, readOnly(mux))
+}
+
+// readOnly rejects requests that could change anything
+func readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// files returns the files of the snapshot at ref, or of the datastore
+// for the current snapshot
+func (b *Browser) files(r *http.Request, ref string) (map[string]*zync.File, error) {
+	files := make(map[string]*zync.File)
+	if ref == current {
+		b.store.RangeStore(func(file *watcher.File) bool {
+			status := file.Status()
+			files[absolute(status.AbsolutePath)] = status
+			return false
+		})
+		return files, nil
+	}
+
+	cid, err := b.store.ResolveManifest(r.Context(), ref)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := b.store.Manifest(r.Context(), cid)
+	if err != nil {
+		return nil, err
+	}
+	for path, file := range manifest {
+		files[absolute(path.String())] = file.Status()
+	}
+	return files, nil
+}
+
+// snapshots serves the history at /snapshots/, the directories of a
+// snapshot at /snapshots/REF/DIR/ and its files at /snapshots/REF/PATH
+func (b *Browser) snapshots(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/snapshots/")
+	if rest == "" {
+		b.render(w, &page{Title: "history", Snapshots: b.store.History()})
+		return
+	}
+
+	ref := rest
+	dir := "/"
+	if i := strings.Index(rest, "/"); i >= 0 {
+		ref, dir = rest[:i], rest[i:]
+	}
+	files, err := b.files(r, ref)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if file, ok := files[dir]; ok {
+		b.download(w, r, file)
+		return
+	}
+	if !strings.HasSuffix(dir, "/") {
+		if len(listDirectory(files, ref, dir+"/")) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusFound)
+		return
+	}
+
+	entries := listDirectory(files, ref, dir)
+	if len(entries) == 0 && dir != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	b.render(w, &page{
+		Title:   snapshotTitle(ref),
+		Crumbs:  crumbs("/snapshots/"+ref, dir),
+		Entries: entries,
+	})
+}
+
+// versions serves the versions of the file at /versions/PATH, a page at
+// a time. The before query parameter selects the page of versions older
+// than the given snapshot
+func (b *Browser) versions(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/versions")
+	before := watcher.CID(r.URL.Query().Get("before"))
+	// one more version than is listed tells whether there are older ones
+	found, err := b.store.Versions(r.Context(), watcher.FilePath(path), before, versionsPerPage+1)
+	if errors.Is(err, watcher.ErrUnknownSnapshot) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(found) == 0 {
+		// paths may be recorded relative to where they were added
+		found, err = b.store.Versions(r.Context(), watcher.FilePath(strings.TrimPrefix(path, "/")), before, versionsPerPage+1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var older string
+	if len(found) > versionsPerPage {
+		found = found[:versionsPerPage]
+		older = "/versions" + escapePath(path) + "?before=" + url.QueryEscape(found[len(found)-1].Snapshot.CID.String())
+	}
+
+	versions := make([]version, 0, len(found))
+	for _, v := range found {
+		versions = append(versions, version{
+			Version: v,
+			URL:     "/snapshots/" + v.Snapshot.CID.String() + escapePath(path),
+		})
+	}
+	b.render(w, &page{
+		Title:    "versions of " + path,
+		Crumbs:   crumbs("/snapshots/"+current, path),
+		Versions: versions,
+		Older:    older,
+	})
+}
+
+// download streams the contents of the file from the backend. Files are
+// sandboxed, so that HTML files cannot run scripts with access to the
+// browser
+func (b *Browser) download(w http.ResponseWriter, r *http.Request, file *zync.File) {
+	contents, err := b.store.Cat(r.Context(), watcher.CID(file.Cid))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer contents.Close()
+
+	name := path.Base(file.AbsolutePath)
+	br := bufio.NewReader(contents)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		head, _ := br.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+	disposition := "inline"
+	if r.URL.Query().Get("download") != "" {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	// a size of 0 is unknown, as sizes were not always recorded
+	if file.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	}
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	w.Header().Set("ETag", strconv.Quote(file.Cid))
+	// the contents of a CID never change
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := io.Copy(w, br); err != nil {
+		log.WithFields(log.Fields{"path": file.AbsolutePath, "cid": file.Cid, "op": "browse"}).WithError(err).
+			Warn("could not send file")
+	}
+}
+
+func (b *Browser) render(w http.ResponseWriter, p *page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := browserTemplate.Execute(w, p); err != nil {
+		log.WithField("op", "browse").WithError(err).Warn("could not render page")
+	}
+}
+
+// listDirectory returns the files and directories directly within dir,
+// directories first
+func listDirectory(files map[string]*zync.File, ref, dir string) []entry {
+	dirs := make(map[string]*entry)
+	var entries []entry
+	for p, file := range files {
+		if !strings.HasPrefix(p, dir) {
+			continue
+		}
+		name := strings.TrimPrefix(p, dir)
+		if i := strings.Index(name, "/"); i >= 0 {
+			name = name[:i]
+			d, ok := dirs[name]
+			if !ok {
+				d = &entry{
+					Name: name,
+					URL:  "/snapshots/" + ref + escapePath(dir+name) + "/",
+					Dir:  true,
+				}
+				dirs[name] = d
+			}
+			d.Files++
+			continue
+		}
+		e := entry{
+			Name:     name,
+			URL:      "/snapshots/" + ref + escapePath(p),
+			Size:     file.Size,
+			CID:      file.Cid,
+			Versions: "/versions" + escapePath(p),
+		}
+		if file.ModTime != nil {
+			e.ModTime = file.ModTime.AsTime()
+		}
+		entries = append(entries, e)
+	}
+	for _, d := range dirs {
+		entries = append(entries, *d)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Dir != entries[j].Dir {
+			return entries[i].Dir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// crumbs links to every directory leading to path
+func crumbs(base, path string) []crumb {
+	c := []crumb{{Name: "/", URL: base + "/"}}
+	dir := "/"
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		dir += name + "/"
+		c = append(c, crumb{Name: name, URL: base + escapePath(dir)})
+	}
+	return c
+}
+
+func snapshotTitle(ref string) string {
+	if ref == current {
+		return "current files"
+	}
+	return "snapshot " + ref
+}
+
+// absolute roots paths that were recorded relative to where they were
+// added, so that they can be browsed like every other path
+func absolute(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return path
+	}
+	return "/" + path
+}
+
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dnjp/zync/watcher"
+	gocid "github.com/ipfs/go-cid"
+	shell "github.com/ipfs/go-ipfs-api"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// newFakeIPFS starts an IPFS node that keeps what is added in memory,
+// serving only what the browser needs
+func newFakeIPFS(t *testing.T) *shell.Shell {
+	t.Helper()
+	var mux sync.Mutex
+	blocks := make(map[string][]byte)
+	fail := func(w http.ResponseWriter, message string) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"Message": message, "Code": 0, "Type": "error"})
+	}
+
+	handler := http.NewServeMux()
+	handler.HandleFunc("/api/v0/add", func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			fail(w, err.Error())
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			fail(w, err.Error())
+			return
+		}
+		b, err := ioutil.ReadAll(part)
+		if err != nil {
+			fail(w, err.Error())
+			return
+		}
+		hash, _ := mh.Sum(b, mh.SHA2_256, -1)
+		cid := gocid.NewCidV0(hash).String()
+		mux.Lock()
+		blocks[cid] = b
+		mux.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"Hash": cid, "Name": cid})
+	})
+	handler.HandleFunc("/api/v0/cat", func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		b, ok := blocks[strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/")]
+		mux.Unlock()
+		if !ok {
+			fail(w, "block not found")
+			return
+		}
+		w.Write(b)
+	})
+	handler.HandleFunc("/api/v0/pin/add", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]string{"Pins": {r.URL.Query().Get("arg")}})
+	})
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return shell.NewShell(server.URL)
+}
+
+// newTestStore constructs a datastore backed by a fake IPFS node, which
+// is stopped when the test ends
+func newTestStore(t *testing.T) *watcher.Datastore {
+	t.Helper()
+	store, err := watcher.NewDatastore(newFakeIPFS(t), watcher.Settings{
+		BackupLocation:  filepath.Join(t.TempDir(), "cid"),
+		RefreshInterval: time.Hour,
+		ConflictPolicy:  watcher.PreferLocal,
+	})
+	if err != nil {
+		t.Fatalf("NewDatastore: %v", err)
+	}
+	t.Cleanup(func() { store.Stop() })
+	return store
+}
+
+// newTestBrowser serves a browser of a datastore tracking a file, next
+// to which is a file that is not tracked. It returns the directory of
+// both
+func newTestBrowser(t *testing.T, token string) (http.Handler, string) {
+	t.Helper()
+	store := newTestStore(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "secret"), []byte("not tracked"))
+	if _, err := store.AddFile(watcher.FilePath(writeFile(t, filepath.Join(dir, "notes"), []byte("tracked")))); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	return NewBrowser(store, func() string { return token }).Handler(), dir
+}
+
+func get(h http.Handler, path string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestBrowserServesOnlyTrackedFiles(t *testing.T) {
+	h, dir := newTestBrowser(t, "")
+
+	w := get(h, "/snapshots/current"+dir+"/notes", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "tracked" {
+		t.Fatalf("tracked file: %d %q, want 200 %q", w.Code, w.Body.String(), "tracked")
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/snapshots/current" + dir + "/secret", want: http.StatusNotFound},
+		{path: "/snapshots/current" + dir + "/secret/", want: http.StatusNotFound},
+		{path: "/snapshots/current/etc/passwd", want: http.StatusNotFound},
+		// cleaned, and then not found
+		{path: "/snapshots/current" + dir + "/../../etc/passwd", want: http.StatusMovedPermanently},
+		// lists no versions
+		{path: "/versions" + dir + "/secret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := get(h, tt.path, nil)
+		if w.Code != tt.want || strings.Contains(w.Body.String(), "not tracked") {
+			t.Errorf("%s: %d %q, want %d without the file", tt.path, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestBrowserRequiresToken(t *testing.T) {
+	h, dir := newTestBrowser(t, "secret")
+	path := "/snapshots/current" + dir + "/notes"
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "missing token", want: http.StatusUnauthorized},
+		{name: "wrong token", header: http.Header{"Authorization": {"Bearer guess"}}, want: http.StatusUnauthorized},
+		{name: "wrong password", header: basicAuth("zync", "guess"), want: http.StatusUnauthorized},
+		{name: "bearer token", header: http.Header{"Authorization": {"Bearer secret"}}, want: http.StatusOK},
+		{name: "password", header: basicAuth("anyone", "secret"), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(h, path, tt.header)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code != http.StatusOK && strings.Contains(w.Body.String(), "tracked") {
+				t.Fatal("contents were sent without the token")
+			}
+		})
+	}
+}
+
+func basicAuth(user, password string) http.Header {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth(user, password)
+	return r.Header
+}
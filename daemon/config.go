@@ -0,0 +1,184 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"github.com/dnjp/zync/watcher"
+	shell "github.com/ipfs/go-ipfs-api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Config configures the daemon
+type Config struct {
+	// Addresses are served by the daemon. See Listen for the supported
+	// addresses
+	Addresses []string
+	// Shell is the client for the IPFS API
+	Shell *shell.Shell
+	// Settings configures the datastore
+	Settings watcher.Settings
+	// Security protects connections made over TCP
+	Security Security
+	// MetricsAddress is the TCP address Prometheus metrics are served on
+	// at /metrics. Metrics are not served when empty
+	MetricsAddress string
+	// BrowserAddress is the TCP address snapshots are browsable on over
+	// HTTP, protected like the API. Snapshots are not served when empty
+	BrowserAddress string
+	// GatewayAddress is the TCP address the API is served on over HTTP
+	// with JSON bodies, protected like the API. It is not served when
+	// empty
+	GatewayAddress string
+}
+
+// validate checks the parts of the configuration that the daemon refuses
+// to run with
+func (c Config) validate() error {
+	// the API is only served to other machines when they must prove who
+	// they are
+	for _, address := range c.Addresses {
+		if strings.HasPrefix(address, unixScheme) {
+			continue
+		}
+		if !isLoopback(address) && c.Security.Token == "" && c.Security.ClientCAFile == "" {
+			return fmt.Errorf("address %s is not a loopback address, which requires an auth token or client certificates", address)
+		}
+		// clients only send tokens over TLS
+		if c.Security.Token != "" && !c.Security.TLSEnabled() {
+			return fmt.Errorf("address %s is protected by an auth token, which requires tls_cert and tls_key", address)
+		}
+	}
+	// the browser serves the contents of every file
+	if c.BrowserAddress != "" && !isLoopback(c.BrowserAddress) &&
+		c.Security.Token == "" && c.Security.ClientCAFile == "" {
+		return fmt.Errorf("browser address %s is not a loopback address, which requires an auth token or client certificates", c.BrowserAddress)
+	}
+	// the gateway can change files, so it is only served without a
+	// token to processes on the same machine
+	if c.GatewayAddress != "" && c.Security.Token == "" && !isLoopback(c.GatewayAddress) {
+		return fmt.Errorf("gateway address %s is not a loopback address, which requires an auth token", c.GatewayAddress)
+	}
+	return nil
+}
+
+// Loader reads the configuration of the daemon
+type Loader func() (Config, error)
+
+// Config returns the configuration the server is running with
+func (s *Server) Config() Config {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.config
+}
+
+// HandleReload reloads the configuration of the server if the
+// reload signal is received
+func (s *Server) HandleReload(sig os.Signal) error {
+	if err := Notify("RELOADING=1"); err != nil {
+		log.WithError(err).Warn("could not notify service manager")
+	}
+	if _, err := s.reload(); err != nil {
+		// keep serving with the previous configuration
+		log.WithField("op", "reload").WithError(err).Error("could not reload configuration")
+	}
+	if err := Notify("READY=1"); err != nil {
+		log.WithError(err).Warn("could not notify service manager")
+	}
+	return nil
+}
+
+// reload reads the configuration again and applies it. Listeners and
+// TLS are only configured when the server starts, so changes to them
+// are reported but not applied
+func (s *Server) reload() (*zync.ReloadStatus, error) {
+	cfg, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	// listeners keep serving on their addresses until a restart, and
+	// must stay protected there too
+	running := cfg
+	running.Addresses = s.Config().Addresses
+	running.BrowserAddress = s.Config().BrowserAddress
+	running.GatewayAddress = s.Config().GatewayAddress
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if err := running.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Security.TLSEnabled() {
+		if _, err := cfg.Security.TLSConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	status := &zync.ReloadStatus{}
+	if !reflect.DeepEqual(cfg.Addresses, s.config.Addresses) {
+		status.RequiresRestart = append(status.RequiresRestart, fmt.Sprintf(
+			"listen addresses changed from %v to %v",
+			s.config.Addresses,
+			cfg.Addresses,
+		))
+	}
+	if cfg.MetricsAddress != s.config.MetricsAddress {
+		status.RequiresRestart = append(status.RequiresRestart, fmt.Sprintf(
+			"metrics address changed from %q to %q",
+			s.config.MetricsAddress,
+			cfg.MetricsAddress,
+		))
+	}
+	if cfg.BrowserAddress != s.config.BrowserAddress {
+		status.RequiresRestart = append(status.RequiresRestart, fmt.Sprintf(
+			"browser address changed from %q to %q",
+			s.config.BrowserAddress,
+			cfg.BrowserAddress,
+		))
+	}
+	if cfg.GatewayAddress != s.config.GatewayAddress {
+		status.RequiresRestart = append(status.RequiresRestart, fmt.Sprintf(
+			"gateway address changed from %q to %q",
+			s.config.GatewayAddress,
+			cfg.GatewayAddress,
+		))
+	}
+	prev, next := s.config.Security, cfg.Security
+	if prev.CertFile != next.CertFile || prev.KeyFile != next.KeyFile || prev.ClientCAFile != next.ClientCAFile {
+		status.RequiresRestart = append(status.RequiresRestart, "tls configuration changed")
+	}
+	if prev.Token != next.Token {
+		status.Applied = append(status.Applied, "auth token changed")
+	}
+
+	status.Applied = append(status.Applied, s.store.Reload(cfg.Shell, cfg.Settings)...)
+
+	s.config.Shell = cfg.Shell
+	s.config.Settings = cfg.Settings
+	s.config.Security.Token = cfg.Security.Token
+
+	for _, change := range status.Applied {
+		log.WithField("op", "reload").Info(change)
+	}
+	for _, change := range status.RequiresRestart {
+		log.WithField("op", "reload").Warn(change + " (requires restart)")
+	}
+	if len(status.Applied) == 0 && len(status.RequiresRestart) == 0 {
+		log.WithField("op", "reload").Info("no changes")
+	}
+
+	return status, nil
+}
+
+// Reload re-reads the configuration of the daemon and applies
+// it without restarting
+func (s *Server) Reload(ctx context.Context, req *zync.ReloadRequest) (*zync.ReloadStatus, error) {
+	return s.reload()
+}
@@ -0,0 +1,81 @@
+package daemon
+
+import "testing"
+
+func TestValidateGatewayAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		token   string
+		wantErr bool
+	}{
+		{address: ""},
+		{address: "localhost:8090"},
+		{address: "127.0.0.1:8090"},
+		{address: "[::1]:8090"},
+		{address: ":8090", wantErr: true},
+		{address: "0.0.0.0:8090", wantErr: true},
+		{address: "nas.local:8090", wantErr: true},
+		{address: "192.168.1.10:8090", wantErr: true},
+		{address: "0.0.0.0:8090", token: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			cfg := Config{GatewayAddress: tt.address, Security: Security{Token: tt.token}}
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateListenAddresses(t *testing.T) {
+	tests := []struct {
+		address  string
+		security Security
+		wantErr  bool
+	}{
+		{address: "unix:///run/user/1000/zyncd.sock"},
+		{address: "localhost:8081"},
+		{address: "127.0.0.1:8081"},
+		{address: "0.0.0.0:8081", wantErr: true},
+		{address: "nas.local:8081", wantErr: true},
+		{address: "nas.local:8081", security: Security{CertFile: "cert.pem", KeyFile: "key.pem"}, wantErr: true},
+		{address: "nas.local:8081", security: Security{Token: "secret"}, wantErr: true},
+		{address: "localhost:8081", security: Security{Token: "secret"}, wantErr: true},
+		{address: "unix:///run/user/1000/zyncd.sock", security: Security{Token: "secret"}},
+		{address: "nas.local:8081", security: Security{CertFile: "cert.pem", KeyFile: "key.pem", Token: "secret"}},
+		{address: "nas.local:8081", security: Security{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			cfg := Config{Addresses: []string{tt.address}, Security: tt.security}
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateBrowserAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		security Security
+		wantErr  bool
+	}{
+		{address: ""},
+		{address: "localhost:8089"},
+		{address: "127.0.0.1:8089"},
+		{address: "0.0.0.0:8089", wantErr: true},
+		{address: "nas.local:8089", wantErr: true},
+		{address: "0.0.0.0:8089", security: Security{Token: "secret"}},
+		{address: "0.0.0.0:8089", security: Security{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			cfg := Config{BrowserAddress: tt.address, Security: tt.security}
+			if err := cfg.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxRequestSize bounds the JSON body of a gateway request
+const maxRequestSize = 1 << 20
+
+var (
+	marshaler = protojson.MarshalOptions{
+		UseProtoNames:   true,
+		EmitUnpopulated: true,
+	}
+	unmarshaler = protojson.UnmarshalOptions{}
+)
+
+// Gateway serves the zync.v1 service over HTTP with JSON bodies, so
+// that clients without gRPC stubs can call it. Server streams are
+// rendered as newline delimited JSON, one message per line
+type Gateway struct {
+	server *Server
+	token  func() string
+}
+
+// NewGateway constructs a gateway calling the server. When token returns
+// a non-empty token, requests must present it as a bearer token or as
+// the password of HTTP basic auth
+func NewGateway(server *Server, token func() string) *Gateway {
+	return &Gateway{server: server, token: token}
+}
+
+// methods routes requests for a path by their method
+type methods map[string]http.HandlerFunc
+
+func (m methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := m[r.Method]
+	if !ok {
+		writeError(w, status.Errorf(codes.Unimplemented, "method %s is not allowed", r.Method))
+		return
+	}
+	handler(w, r)
+}
+
+// Handler serves the gateway
+func (g *Gateway) Handler() http.Handler {
+	s := g.server
+	mux := http.NewServeMux()
+	mux.Handle("/v1/files", methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			if req, ok := regexRequest(w, r); ok {
+				stream(w, r, func(ns *ndjsonStream) error { return s.ListFiles(req, fileStream{ns}) })
+			}
+		},
+		http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.RegexRequest{}
+			if decode(w, r, req) {
+				stream(w, r, func(ns *ndjsonStream) error { return s.AddFiles(req, fileStream{ns}) })
+			}
+		},
+		http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+			if req, ok := regexRequest(w, r); ok {
+				stream(w, r, func(ns *ndjsonStream) error { return s.DeleteFiles(req, fileStream{ns}) })
+			}
+		},
+	})
+	mux.Handle("/v1/backup", methods{
+		http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.BackupRequest{}
+			if decode(w, r, req) {
+				unary(w, func() (proto.Message, error) { return s.Backup(r.Context(), req) })
+			}
+		},
+	})
+	mux.Handle("/v1/snapshots", methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.ListSnapshotsRequest{Label: r.URL.Query().Get("label")}
+			stream(w, r, func(ns *ndjsonStream) error { return s.ListSnapshots(req, snapshotStream{ns}) })
+		},
+	})
+	mux.Handle("/v1/restore", methods{
+		http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.RestoreRequest{}
+			if decode(w, r, req) {
+				stream(w, r, func(ns *ndjsonStream) error { return s.Restore(req, restoreStream{ns}) })
+			}
+		},
+	})
+	mux.Handle("/v1/undo", methods{
+		http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.UndoRequest{}
+			if decode(w, r, req) {
+				stream(w, r, func(ns *ndjsonStream) error { return s.Undo(req, restoreStream{ns}) })
+			}
+		},
+	})
+	mux.Handle("/v1/tags", methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			stream(w, r, func(ns *ndjsonStream) error { return s.ListTags(&zync.ListTagsRequest{}, tagStream{ns}) })
+		},
+		http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.AddTagRequest{}
+			if decode(w, r, req) {
+				unary(w, func() (proto.Message, error) { return s.AddTag(r.Context(), req) })
+			}
+		},
+		http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.RemoveTagRequest{Name: r.URL.Query().Get("name")}
+			unary(w, func() (proto.Message, error) { return s.RemoveTag(r.Context(), req) })
+		},
+	})
+	mux.Handle("/v1/conflicts", methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			if req, ok := regexRequest(w, r); ok {
+				stream(w, r, func(ns *ndjsonStream) error { return s.ListConflicts(req, conflictStream{ns}) })
+			}
+		},
+	})
+	mux.Handle("/v1/conflicts/resolve", methods{
+		http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			req := &zync.ResolveRequest{}
+			if decode(w, r, req) {
+				stream(w, r, func(ns *ndjsonStream) error { return s.ResolveConflicts(req, conflictStream{ns}) })
+			}
+		},
+	})
+	mux.Handle("/v1/events", methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			if req, ok := regexRequest(w, r); ok {
+				stream(w, r, func(ns *ndjsonStream) error { return s.WatchEvents(req, eventStream{ns}) })
+			}
+		},
+	})
+	mux.Handle("/v1/status", methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			unary(w, func() (proto.Message, error) { return s.Status(r.Context(), &zync.StatusRequest{}) })
+		},
+	})
+	mux.Handle("/v1/verify", methods{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			if req, ok := regexRequest(w, r); ok {
+				stream(w, r, func(ns *ndjsonStream) error { return s.Verify(req, verificationStream{ns}) })
+			}
+		},
+	})
+	mux.Handle("/v1/reload", methods{
+		http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+			unary(w, func() (proto.Message, error) { return s.Reload(r.Context(), &zync.ReloadRequest{}) })
+		},
+	})
+	return authorizeHTTP(g.token, requireJSON(mux))
+}
+
+// requireJSON refuses POST requests that are not declared as JSON, even
+// those without a body. Browsers only send JSON across origins after a
+// CORS preflight, which the gateway never allows, so web pages cannot
+// call it on behalf of the user
+func requireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				w.Header().Set("Accept", "application/json")
+				writeStatus(w, http.StatusUnsupportedMediaType,
+					status.New(codes.InvalidArgument, "content type must be application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// regexRequest reads the pattern, pattern_type, current_directory, all,
+// dry_run, max_files and repeated path query parameters. It writes the
+// error and returns false if they are invalid
+func regexRequest(w http.ResponseWriter, r *http.Request) (*zync.RegexRequest, bool) {
+	query := r.URL.Query()
+	req := &zync.RegexRequest{
+		Pattern:          query.Get("pattern"),
+		CurrentDirectory: query.Get("current_directory"),
+		Paths:            query["path"],
+	}
+
+	var err error
+	if v := query.Get("pattern_type"); v != "" {
+		value, ok := zync.PatternType_value[v]
+		if !ok {
+			err = fmt.Errorf("unknown pattern_type %q", v)
+		}
+		req.PatternType = zync.PatternType(value)
+	}
+	if v := query.Get("all"); v != "" && err == nil {
+		req.All, err = strconv.ParseBool(v)
+	}
+	if v := query.Get("dry_run"); v != "" && err == nil {
+		req.DryRun, err = strconv.ParseBool(v)
+	}
+	if v := query.Get("max_files"); v != "" && err == nil {
+		req.MaxFiles, err = strconv.ParseInt(v, 10, 64)
+	}
+	if err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return nil, false
+	}
+	return req, true
+}
+
+// decode reads the JSON body of the request into req, which is left
+// empty when there is no body. It writes the error and returns false if
+// the body is invalid
+func decode(w http.ResponseWriter, r *http.Request, req proto.Message) bool {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return false
+	}
+	if len(b) == 0 {
+		return true
+	}
+	if err := unmarshaler.Unmarshal(b, req); err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return false
+	}
+	return true
+}
+
+// unary writes the response of a call as JSON
+func unary(w http.ResponseWriter, call func() (proto.Message, error)) {
+	resp, err := call()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	b, err := marshaler.Marshal(resp)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+// stream writes every message sent by a call as a line of JSON. Errors
+// returned before the first message are reported with an HTTP status,
+// and later errors as a final {"error": ...} line
+func stream(w http.ResponseWriter, r *http.Request, call func(*ndjsonStream) error) {
+	ns := &ndjsonStream{ctx: r.Context(), w: w}
+	err := call(ns)
+	if err == nil {
+		if !ns.started {
+			ns.start()
+		}
+		return
+	}
+	if !ns.started {
+		writeError(w, err)
+		return
+	}
+
+	b, merr := marshaler.Marshal(status.Convert(err).Proto())
+	if merr != nil {
+		return
+	}
+	w.Write([]byte(`{"error":`))
+	w.Write(b)
+	w.Write([]byte("}\n"))
+}
+
+// writeError reports the error with the HTTP status matching its gRPC
+// code and a JSON body holding the code and message
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	writeStatus(w, httpStatus(st.Code()), st)
+}
+
+// writeStatus reports the status with the given HTTP status code
+func writeStatus(w http.ResponseWriter, code int, st *status.Status) {
+	b, err := marshaler.Marshal(st.Proto())
+	if err != nil {
+		http.Error(w, st.Message(), code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(append(b, '\n'))
+}
+
+// httpStatus maps gRPC codes to the closest HTTP status
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// ndjsonStream implements the server side of a gRPC stream by writing
+// each message sent as a line of JSON
+type ndjsonStream struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	started bool
+}
+
+func (s *ndjsonStream) start() {
+	s.started = true
+	s.w.Header().Set("Content-Type", "application/x-ndjson")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *ndjsonStream) SetHeader(metadata.MD) error  { return nil }
+func (s *ndjsonStream) SendHeader(metadata.MD) error { return nil }
+func (s *ndjsonStream) SetTrailer(metadata.MD)       {}
+func (s *ndjsonStream) Context() context.Context     { return s.ctx }
+func (s *ndjsonStream) RecvMsg(m interface{}) error  { return io.EOF }
+
+func (s *ndjsonStream) SendMsg(m interface{}) error {
+	b, err := marshaler.Marshal(m.(proto.Message))
+	if err != nil {
+		return err
+	}
+	if !s.started {
+		s.start()
+	}
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	// deliver each message as it is sent, which matters for streams
+	// that never end like events
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+type fileStream struct{ *ndjsonStream }
+
+func (s fileStream) Send(m *zync.File) error { return s.SendMsg(m) }
+
+type restoreStream struct{ *ndjsonStream }
+
+func (s restoreStream) Send(m *zync.RestoreStatusUpdate) error { return s.SendMsg(m) }
+
+type snapshotStream struct{ *ndjsonStream }
+
+func (s snapshotStream) Send(m *zync.Snapshot) error { return s.SendMsg(m) }
+
+type tagStream struct{ *ndjsonStream }
+
+func (s tagStream) Send(m *zync.Tag) error { return s.SendMsg(m) }
+
+type conflictStream struct{ *ndjsonStream }
+
+func (s conflictStream) Send(m *zync.Conflict) error { return s.SendMsg(m) }
+
+type eventStream struct{ *ndjsonStream }
+
+func (s eventStream) Send(m *zync.Event) error { return s.SendMsg(m) }
+
+type verificationStream struct{ *ndjsonStream }
+
+func (s verificationStream) Send(m *zync.Verification) error { return s.SendMsg(m) }
+
+// the streams stand in for the generated server streams
+var (
+	_ zync.Zync_ListFilesServer        = fileStream{}
+	_ zync.Zync_AddFilesServer         = fileStream{}
+	_ zync.Zync_DeleteFilesServer      = fileStream{}
+	_ zync.Zync_RestoreServer          = restoreStream{}
+	_ zync.Zync_UndoServer             = restoreStream{}
+	_ zync.Zync_ListSnapshotsServer    = snapshotStream{}
+	_ zync.Zync_ListTagsServer         = tagStream{}
+	_ zync.Zync_ListConflictsServer    = conflictStream{}
+	_ zync.Zync_ResolveConflictsServer = conflictStream{}
+	_ zync.Zync_WatchEventsServer      = eventStream{}
+	_ zync.Zync_VerifyServer           = verificationStream{}
+)
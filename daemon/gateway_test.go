@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dnjp/zync/watcher"
+)
+
+func TestRequireJSON(t *testing.T) {
+	handler := requireJSON(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method      string
+		contentType string
+		want        int
+	}{
+		{method: http.MethodPost, contentType: "application/json", want: http.StatusNoContent},
+		{method: http.MethodPost, contentType: "application/json; charset=utf-8", want: http.StatusNoContent},
+		{method: http.MethodPost, contentType: "text/plain", want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, contentType: "application/x-www-form-urlencoded", want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, contentType: "multipart/form-data; boundary=x", want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, contentType: "", want: http.StatusUnsupportedMediaType},
+		{method: http.MethodGet, contentType: "", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.contentType, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/restore", strings.NewReader(`{"cid": "QmT8Mb1Ke4GVZoEZtzYQ4VhHzTS4ehTHwMfsDfGvhVwpAp"}`))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestGatewayScopesPatterns(t *testing.T) {
+	store := newTestStore(t)
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		path := writeFile(t, filepath.Join(dir, name, "notes.md"), []byte(name))
+		if _, err := store.AddFile(watcher.FilePath(path)); err != nil {
+			t.Fatalf("AddFile: %v", err)
+		}
+	}
+	h := NewGateway(&Server{store: store}, func() string { return "" }).Handler()
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{
+			name:  "glob within the current directory",
+			query: url.Values{"pattern": {"*.md"}, "pattern_type": {"PATTERN_TYPE_GLOB"}, "current_directory": {filepath.Join(dir, "a")}},
+			want:  []string{filepath.Join(dir, "a", "notes.md")},
+		},
+		{
+			name:  "glob leading out of the current directory",
+			query: url.Values{"pattern": {"../b/*.md"}, "pattern_type": {"PATTERN_TYPE_GLOB"}, "current_directory": {filepath.Join(dir, "a")}},
+			want:  []string{filepath.Join(dir, "b", "notes.md")},
+		},
+		{
+			name:  "glob anywhere",
+			query: url.Values{"pattern": {"*.md"}, "pattern_type": {"PATTERN_TYPE_GLOB"}, "current_directory": {filepath.Join(dir, "a")}, "all": {"true"}},
+			want:  []string{filepath.Join(dir, "a", "notes.md"), filepath.Join(dir, "b", "notes.md")},
+		},
+		{
+			name:  "regex relative to the current directory",
+			query: url.Values{"pattern": {"^notes"}, "current_directory": {filepath.Join(dir, "b")}},
+			want:  []string{filepath.Join(dir, "b", "notes.md")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(h, "/v1/verify?"+tt.query.Encode(), nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+			var got []string
+			dec := json.NewDecoder(w.Body)
+			for dec.More() {
+				var verification struct {
+					AbsolutePath string `json:"absolute_path"`
+				}
+				if err := dec.Decode(&verification); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, verification.AbsolutePath)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("verified %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
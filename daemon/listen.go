@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const unixScheme = "unix://"
+
+// DefaultURL returns the url clients use to reach the daemon when none
+// is configured
+func DefaultURL() string {
+	return unixScheme + DefaultSocket()
+}
+
+// Listen returns a listener for the given address. Addresses beginning
+// with unix:// are served on a Unix socket that only the current user
+// can connect to, and all other addresses are served over TCP
+func Listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, unixScheme) {
+		return net.Listen("tcp", strings.TrimPrefix(address, "tcp://"))
+	}
+	return listenUnix(strings.TrimPrefix(address, unixScheme))
+}
+
+// listenTCP returns a listener for the TCP address, serving TLS when
+// config is set
+func listenTCP(address string, config *tls.Config) (net.Listener, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	}
+	return l, nil
+}
+
+// isLoopback reports whether the TCP address only accepts connections
+// from the local machine
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(strings.TrimPrefix(address, "tcp://"))
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	// a socket left behind by a daemon that did not exit cleanly would
+	// prevent listening, so remove it unless a daemon is still serving it
+	if _, err := os.Stat(path); err == nil {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use by another daemon", path)
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, err
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// the umask keeps the socket private between creating and chmoding it
+	umask := syscall.Umask(0177)
+	lis, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dnjp/zync/watcher"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics records the events emitted by a datastore in a form that
+// Prometheus can scrape
+type Metrics struct {
+	store          *watcher.Datastore
+	registry       *prometheus.Registry
+	uploads        prometheus.Counter
+	uploadErrors   prometheus.Counter
+	uploadedBytes  prometheus.Counter
+	uploadDuration prometheus.Histogram
+	commits        prometheus.Counter
+	manifestSize   prometheus.Gauge
+	pollDuration   prometheus.Histogram
+	errors         prometheus.Counter
+}
+
+// NewMetrics constructs the metrics for the datastore. Metrics are only
+// recorded once Listen is called
+func NewMetrics(store *watcher.Datastore) *Metrics {
+	m := &Metrics{
+		store:    store,
+		registry: prometheus.NewRegistry(),
+		uploads: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zync_uploads_total",
+			Help: "Files successfully added and pinned in IPFS.",
+		}),
+		uploadErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zync_upload_errors_total",
+			Help: "Attempts to add and pin a file in IPFS that failed.",
+		}),
+		uploadedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zync_uploaded_bytes_total",
+			Help: "Bytes of file contents successfully added to IPFS.",
+		}),
+		uploadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "zync_upload_duration_seconds",
+			Help:    "Time taken to read, add and pin a file.",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+		}),
+		commits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zync_commits_total",
+			Help: "Manifests committed to IPFS.",
+		}),
+		manifestSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "zync_manifest_size_bytes",
+			Help: "Size of the last committed manifest.",
+		}),
+		pollDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "zync_watcher_poll_duration_seconds",
+			Help:    "Time taken by a watcher to check its file for changes.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}),
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "zync_errors_total",
+			Help: "Errors reported by the datastore.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.uploads,
+		m.uploadErrors,
+		m.uploadedBytes,
+		m.uploadDuration,
+		m.commits,
+		m.manifestSize,
+		m.pollDuration,
+		m.errors,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "zync_files_watched",
+			Help: "Files managed by the datastore.",
+		}, func() float64 {
+			return float64(store.Stats().Files)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "zync_pending_uploads",
+			Help: "Uploads in progress.",
+		}, func() float64 {
+			return float64(store.Stats().PendingUploads)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "zync_queued_retries",
+			Help: "Files waiting for another attempt to be stored.",
+		}, func() float64 {
+			return float64(store.Stats().QueuedRetries)
+		}),
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Listen records the events emitted by the datastore until the context
+// is done
+func (m *Metrics) Listen(ctx context.Context) {
+	for event := range m.store.Subscribe(ctx) {
+		m.observe(event)
+	}
+}
+
+func (m *Metrics) observe(event watcher.Event) {
+	switch event.Type {
+	case watcher.EventUpload:
+		m.uploadDuration.Observe(event.Duration.Seconds())
+		if event.Err != nil {
+			m.uploadErrors.Inc()
+			return
+		}
+		m.uploads.Inc()
+		m.uploadedBytes.Add(float64(event.Size))
+	case watcher.EventCommit:
+		m.commits.Inc()
+		m.manifestSize.Set(float64(event.Size))
+	case watcher.EventPoll:
+		m.pollDuration.Observe(event.Duration.Seconds())
+	case watcher.EventError:
+		m.errors.Inc()
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,30 @@
+package daemon
+
+import (
+	"net"
+	"os"
+)
+
+// Notify sends the state to the service manager using the sd_notify
+// protocol, e.g. "READY=1" once the daemon is serving. It does nothing
+// unless the daemon was started by systemd with Type=notify. See
+// https://www.freedesktop.org/software/systemd/man/sd_notify.html
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// a leading @ refers to a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,44 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// runtimeFile returns the path of a file that only lives as long as the
+// daemon runs: the file within $XDG_RUNTIME_DIR, or a per-user file in
+// the temporary directory when that is unset
+func runtimeFile(name, ext string) string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, name+ext)
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%d%s", name, os.Getuid(), ext))
+}
+
+// DefaultSocket returns the path of the Unix socket the daemon listens
+// on when none is configured
+func DefaultSocket() string {
+	return runtimeFile("zyncd", ".sock")
+}
+
+// DefaultPidFile returns the path of the file the daemon writes its
+// process ID to when none is configured
+func DefaultPidFile() string {
+	return runtimeFile("zyncd", ".pid")
+}
+
+// DefaultLogFile returns the path of the file the daemon logs to when
+// none is configured: zync/zyncd.log within $XDG_STATE_HOME, which
+// defaults to ~/.local/state
+func DefaultLogFile() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return runtimeFile("zyncd", ".log")
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "zync", "zyncd.log")
+}
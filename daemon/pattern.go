@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+)
+
+// CompilePattern compiles the pattern of a request into a regex that is
+// matched against absolute paths. Regexes match anywhere in the path.
+// Globs match whole paths: a glob without a slash matches the name of a
+// file in any directory, and a relative glob matches paths relative to
+// currentDirectory, which may lead out of it with .. An empty pattern
+// matches every path
+func CompilePattern(pattern string, patternType zync.PatternType, currentDirectory string) (*regexp.Regexp, error) {
+	switch patternType {
+	case zync.PatternType_PATTERN_TYPE_UNSPECIFIED, zync.PatternType_PATTERN_TYPE_REGEX:
+		return regexp.Compile(pattern)
+	case zync.PatternType_PATTERN_TYPE_GLOB:
+		if pattern == "" {
+			return regexp.Compile("")
+		}
+		return compileGlob(pattern, currentDirectory)
+	}
+	return nil, fmt.Errorf("unknown pattern type %v", patternType)
+}
+
+func compileGlob(pattern, currentDirectory string) (*regexp.Regexp, error) {
+	anchor := "^"
+	switch {
+	case !strings.Contains(pattern, "/"):
+		anchor = "(?:^|/)"
+	case filepath.IsAbs(pattern):
+		pattern = filepath.Clean(pattern)
+	default:
+		// paths are clean, so the glob must be too for .. to match.
+		// Without a current directory it is relative to the root
+		pattern = filepath.Join(string(filepath.Separator), currentDirectory, pattern)
+	}
+
+	expr, err := globToRegex(filepath.ToSlash(pattern))
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return regexp.Compile(anchor + expr + "$")
+}
+
+// globToRegex translates a glob into an unanchored regex. * and ? match
+// within a directory, ** matches across directories, [...] matches a
+// class of characters, negated by a leading ! or ^, {a,b} matches
+// either alternative and \ escapes the next character
+func globToRegex(glob string) (string, error) {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				// **/ also matches no directories at all
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("missing closing ]")
+			}
+			class := glob[i+1 : i+1+end]
+			// a ] directly after the [ is part of the class
+			if class == "" || class == "!" || class == "^" {
+				next := strings.IndexByte(glob[i+2+end:], ']')
+				if next < 0 {
+					return "", fmt.Errorf("missing closing ]")
+				}
+				class = glob[i+1 : i+2+end+next]
+			}
+			i += len(class) + 1
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+		case '{':
+			depth++
+			b.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				b.WriteString(`\}`)
+				continue
+			}
+			depth--
+			b.WriteString(")")
+		case ',':
+			if depth == 0 {
+				b.WriteString(",")
+				continue
+			}
+			b.WriteString("|")
+		case '\\':
+			if i+1 == len(glob) {
+				return "", fmt.Errorf("trailing \\")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	if depth > 0 {
+		return "", fmt.Errorf("missing closing }")
+	}
+	return b.String(), nil
+}
+
+// walkRoot returns the directory that holds every file a request can
+// match when adding files. Globs are rooted at their directories before
+// the first wildcard, and everything else at currentDirectory
+func walkRoot(req *zync.RegexRequest) string {
+	if req.PatternType != zync.PatternType_PATTERN_TYPE_GLOB || !strings.Contains(req.Pattern, "/") {
+		return req.CurrentDirectory
+	}
+
+	dirs := strings.Split(filepath.ToSlash(req.Pattern), "/")
+	root := []string{}
+	for _, dir := range dirs[:len(dirs)-1] {
+		if strings.ContainsAny(dir, `*?[{\`) {
+			break
+		}
+		root = append(root, dir)
+	}
+	path := filepath.FromSlash(strings.Join(root, "/"))
+	if filepath.IsAbs(req.Pattern) {
+		return filepath.Join(string(filepath.Separator), path)
+	}
+	return filepath.Join(req.CurrentDirectory, path)
+}
+
+// matcher matches the paths of files against the pattern of a request
+type matcher struct {
+	regex *regexp.Regexp
+	// root scopes matches to the files within it, when set
+	root string
+	// relative matches regexes against paths relative to root
+	relative bool
+}
+
+// newMatcher returns a matcher for the files a request lists or deletes,
+// which are scoped to its current directory unless it asks for all of
+// them. Globs holding a directory name their files explicitly, even when
+// they lead out of it with .., so are not scoped
+func newMatcher(req *zync.RegexRequest) (*matcher, error) {
+	regex, err := CompilePattern(req.Pattern, req.PatternType, req.CurrentDirectory)
+	if err != nil {
+		return nil, err
+	}
+	m := &matcher{regex: regex}
+	glob := req.PatternType == zync.PatternType_PATTERN_TYPE_GLOB
+	if req.All || req.CurrentDirectory == "" || (glob && strings.Contains(req.Pattern, "/")) {
+		return m, nil
+	}
+	m.root = filepath.Clean(req.CurrentDirectory)
+	m.relative = !glob
+	return m, nil
+}
+
+// within reports whether path is root or is inside of it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (m *matcher) match(path string) bool {
+	if m.root == "" {
+		return m.regex.MatchString(path)
+	}
+	if !filepath.IsAbs(path) || !within(m.root, path) {
+		return false
+	}
+	if m.relative {
+		rel, _ := filepath.Rel(m.root, path)
+		return m.regex.MatchString(filepath.ToSlash(rel))
+	}
+	return m.regex.MatchString(path)
+}
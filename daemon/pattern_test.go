@@ -0,0 +1,209 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		glob    string
+		want    string
+		wantErr bool
+	}{
+		{glob: "notes.md", want: `notes\.md`},
+		{glob: "*.md", want: `[^/]*\.md`},
+		{glob: "docs/**/*.md", want: `docs/(?:.*/)?[^/]*\.md`},
+		{glob: "docs/**", want: `docs/.*`},
+		{glob: "note?", want: `note[^/]`},
+		{glob: "[abc].md", want: `[abc]\.md`},
+		{glob: "[!abc].md", want: `[^abc]\.md`},
+		{glob: "[^abc].md", want: `[^abc]\.md`},
+		{glob: "[]a]", want: `[]a]`},
+		{glob: `[a\]`, want: `[a\\]`},
+		{glob: "*.{md,txt}", want: `[^/]*\.(?:md|txt)`},
+		{glob: "a,b}", want: `a,b\}`},
+		{glob: `\*.md`, want: `\*\.md`},
+		{glob: `\[draft\]`, want: `\[draft\]`},
+		{glob: "(1)+$", want: `\(1\)\+\$`},
+		{glob: "[abc", wantErr: true},
+		{glob: "[]", wantErr: true},
+		{glob: "{md,txt", wantErr: true},
+		{glob: `notes\`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			got, err := globToRegex(tt.glob)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("globToRegex() = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("globToRegex() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		glob string
+		cwd  string
+		path string
+		want bool
+	}{
+		{glob: "*.md", cwd: "/home/me", path: "/srv/notes.md", want: true},
+		{glob: "*.md", cwd: "/home/me", path: "/home/me/notes.md.bak"},
+		{glob: "*", cwd: "/home/me", path: "/home/me/docs/notes.md", want: true},
+		{glob: "docs/*.md", cwd: "/home/me", path: "/home/me/docs/notes.md", want: true},
+		{glob: "docs/*.md", cwd: "/home/me", path: "/home/me/docs/2022/notes.md"},
+		{glob: "docs/*.md", cwd: "/home/me", path: "/srv/docs/notes.md"},
+		{glob: "docs/**/*.md", cwd: "/home/me", path: "/home/me/docs/notes.md", want: true},
+		{glob: "docs/**/*.md", cwd: "/home/me", path: "/home/me/docs/2022/01/notes.md", want: true},
+		{glob: "docs/note?.md", cwd: "/home/me", path: "/home/me/docs/notes.md", want: true},
+		{glob: "docs/note?.md", cwd: "/home/me", path: "/home/me/docs/note/.md"},
+		{glob: "docs/[!a-m]*", cwd: "/home/me", path: "/home/me/docs/notes.md", want: true},
+		{glob: "docs/[!a-m]*", cwd: "/home/me", path: "/home/me/docs/drafts.md"},
+		{glob: `docs/\*`, cwd: "/home/me", path: "/home/me/docs/*", want: true},
+		{glob: `docs/\*`, cwd: "/home/me", path: "/home/me/docs/notes.md"},
+		{glob: "docs/*.md", cwd: "/home/me/", path: "/home/me/docs/notes.md", want: true},
+		{glob: "docs/*.md", cwd: "/home/(me)", path: "/home/(me)/docs/notes.md", want: true},
+		{glob: "../docs/*.md", cwd: "/home/me/src", path: "/home/me/docs/notes.md", want: true},
+		{glob: "../docs/*.md", cwd: "/home/me/src", path: "/home/me/src/docs/notes.md"},
+		{glob: "./docs/../*.md", cwd: "/home/me", path: "/home/me/notes.md", want: true},
+		{glob: "docs/*.md", path: "/docs/notes.md", want: true},
+		{glob: "/srv/*.md", cwd: "/home/me", path: "/srv/notes.md", want: true},
+		{glob: "/srv/*.md", cwd: "/home/me", path: "/home/me/srv/notes.md"},
+		{glob: "/srv/old/../*.md", cwd: "/home/me", path: "/srv/notes.md", want: true},
+		{glob: "/**/*.md", cwd: "/home/me", path: "/srv/docs/notes.md", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" in "+tt.cwd+" against "+tt.path, func(t *testing.T) {
+			regex, err := CompilePattern(tt.glob, zync.PatternType_PATTERN_TYPE_GLOB, tt.cwd)
+			if err != nil {
+				t.Fatalf("CompilePattern: %v", err)
+			}
+			if got := regex.MatchString(tt.path); got != tt.want {
+				t.Fatalf("%s matches %s = %v, want %v", regex, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkRoot(t *testing.T) {
+	glob := zync.PatternType_PATTERN_TYPE_GLOB
+	tests := []struct {
+		req  *zync.RegexRequest
+		want string
+	}{
+		{req: &zync.RegexRequest{Pattern: "*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/home/me"},
+		{req: &zync.RegexRequest{Pattern: "docs/*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/home/me/docs"},
+		{req: &zync.RegexRequest{Pattern: "docs/2022/note?.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/home/me/docs/2022"},
+		{req: &zync.RegexRequest{Pattern: "docs/**/*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/home/me/docs"},
+		{req: &zync.RegexRequest{Pattern: "docs/[ab]/*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/home/me/docs"},
+		{req: &zync.RegexRequest{Pattern: `docs/\*/*.md`, PatternType: glob, CurrentDirectory: "/home/me"}, want: "/home/me/docs"},
+		{req: &zync.RegexRequest{Pattern: "../docs/*.md", PatternType: glob, CurrentDirectory: "/home/me/src"}, want: "/home/me/docs"},
+		{req: &zync.RegexRequest{Pattern: "/srv/docs/*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/srv/docs"},
+		{req: &zync.RegexRequest{Pattern: "/srv/old/../docs/*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/srv/docs"},
+		{req: &zync.RegexRequest{Pattern: "/*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/"},
+		{req: &zync.RegexRequest{Pattern: "/**/*.md", PatternType: glob, CurrentDirectory: "/home/me"}, want: "/"},
+		{req: &zync.RegexRequest{Pattern: "^/srv/", PatternType: zync.PatternType_PATTERN_TYPE_REGEX, CurrentDirectory: "/home/me"}, want: "/home/me"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.req.Pattern, func(t *testing.T) {
+			if got := walkRoot(tt.req); got != tt.want {
+				t.Fatalf("walkRoot() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMatcher(t *testing.T) {
+	glob, regex := zync.PatternType_PATTERN_TYPE_GLOB, zync.PatternType_PATTERN_TYPE_REGEX
+	tests := []struct {
+		name string
+		req  *zync.RegexRequest
+		path string
+		want bool
+	}{
+		{
+			name: "name within the current directory",
+			req:  &zync.RegexRequest{Pattern: "*.md", PatternType: glob, CurrentDirectory: "/home/me"},
+			path: "/home/me/docs/notes.md",
+			want: true,
+		},
+		{
+			name: "name outside of the current directory",
+			req:  &zync.RegexRequest{Pattern: "*.md", PatternType: glob, CurrentDirectory: "/home/me"},
+			path: "/srv/notes.md",
+		},
+		{
+			name: "name anywhere",
+			req:  &zync.RegexRequest{Pattern: "*.md", PatternType: glob, CurrentDirectory: "/home/me", All: true},
+			path: "/srv/notes.md",
+			want: true,
+		},
+		{
+			name: "current directory named like its sibling",
+			req:  &zync.RegexRequest{Pattern: "*.md", PatternType: glob, CurrentDirectory: "/home/me"},
+			path: "/home/me2/notes.md",
+		},
+		{
+			name: "relative glob",
+			req:  &zync.RegexRequest{Pattern: "docs/*.md", PatternType: glob, CurrentDirectory: "/home/me"},
+			path: "/home/me/docs/notes.md",
+			want: true,
+		},
+		{
+			name: "relative glob leading out of the current directory",
+			req:  &zync.RegexRequest{Pattern: "../docs/*.md", PatternType: glob, CurrentDirectory: "/home/me/src"},
+			path: "/home/me/docs/notes.md",
+			want: true,
+		},
+		{
+			name: "absolute glob",
+			req:  &zync.RegexRequest{Pattern: "/srv/*.md", PatternType: glob, CurrentDirectory: "/home/me"},
+			path: "/srv/notes.md",
+			want: true,
+		},
+		{
+			name: "regex relative to the current directory",
+			req:  &zync.RegexRequest{Pattern: "^docs/", PatternType: regex, CurrentDirectory: "/home/me"},
+			path: "/home/me/docs/notes.md",
+			want: true,
+		},
+		{
+			name: "regex outside of the current directory",
+			req:  &zync.RegexRequest{Pattern: "notes", PatternType: regex, CurrentDirectory: "/home/me"},
+			path: "/srv/notes.md",
+		},
+		{
+			name: "regex against absolute paths",
+			req:  &zync.RegexRequest{Pattern: "^/srv/", PatternType: regex, CurrentDirectory: "/home/me", All: true},
+			path: "/srv/notes.md",
+			want: true,
+		},
+		{
+			name: "everything within the current directory",
+			req:  &zync.RegexRequest{CurrentDirectory: "/home/me"},
+			path: "/home/me/notes.md",
+			want: true,
+		},
+		{
+			name: "nothing outside of the current directory",
+			req:  &zync.RegexRequest{CurrentDirectory: "/home/me"},
+			path: "/srv/notes.md",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := newMatcher(tt.req)
+			if err != nil {
+				t.Fatalf("newMatcher: %v", err)
+			}
+			if got := m.match(tt.path); got != tt.want {
+				t.Fatalf("match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,48 +2,143 @@ package daemon
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io/fs"
-	"log"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/dnjp/zync/proto/zync/v1"
 	"github.com/dnjp/zync/watcher"
-	shell "github.com/ipfs/go-ipfs-api"
+	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Server provides a gRPC interface for interacting
 // with watched files stored in IPFS
 type Server struct {
-	srv   *grpc.Server
-	lis   net.Listener
-	store *watcher.Datastore
+	srv     *grpc.Server
+	lis     []net.Listener
+	store   *watcher.Datastore
+	started time.Time
+	load    Loader
+	config  Config
+	mux     sync.RWMutex
+	// metrics are served over HTTP when an address is configured
+	metrics    *Metrics
+	metricsSrv *http.Server
+	metricsLis net.Listener
+	cancel     context.CancelFunc
+	// snapshots are browsable over HTTP when an address is configured
+	browserSrv *http.Server
+	browserLis net.Listener
+	// the API is served over HTTP when an address is configured
+	gatewaySrv *http.Server
+	gatewayLis net.Listener
 	zync.UnimplementedZyncServer
 }
 
-// NewServer constructs a new gPRC server for the daemon
-func NewServer(port int, sh *shell.Shell, backupLoc string, refreshInterval time.Duration) (*Server, error) {
+// NewServer constructs a new gPRC server for the daemon using
+// the configuration returned by load, which is called again
+// whenever the server is reloaded
+func NewServer(load Loader) (*Server, error) {
 
-	lis, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	cfg, err := load()
 	if err != nil {
 		return nil, err
 	}
+	if len(cfg.Addresses) == 0 {
+		return nil, fmt.Errorf("must provide an address to listen on")
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 
-	store, err := watcher.NewDatastore(sh, backupLoc, refreshInterval)
-	if err != nil {
+	var config *tls.Config
+	if cfg.Security.TLSEnabled() {
+		config, err = cfg.Security.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Server{}
+
+	// close every listener opened so far if the server cannot be
+	// constructed
+	var opened []net.Listener
+	fail := func(err error) (*Server, error) {
+		for _, l := range opened {
+			l.Close()
+		}
 		return nil, err
 	}
 
-	s := &Server{
-		srv:   grpc.NewServer(),
-		lis:   lis,
-		store: store,
+	for _, address := range cfg.Addresses {
+		l, err := Listen(address)
+		if err != nil {
+			return fail(err)
+		}
+		opened = append(opened, l)
+		// unix sockets are protected by their permissions instead
+		if config != nil && l.Addr().Network() != "unix" {
+			l = tls.NewListener(l, config)
+		}
+		s.lis = append(s.lis, l)
+	}
+
+	if cfg.MetricsAddress != "" {
+		if s.metricsLis, err = listenTCP(cfg.MetricsAddress, nil); err != nil {
+			return fail(err)
+		}
+		opened = append(opened, s.metricsLis)
+	}
+
+	if cfg.BrowserAddress != "" {
+		if s.browserLis, err = listenTCP(cfg.BrowserAddress, config); err != nil {
+			return fail(err)
+		}
+		opened = append(opened, s.browserLis)
+	}
+
+	if cfg.GatewayAddress != "" {
+		if s.gatewayLis, err = listenTCP(cfg.GatewayAddress, config); err != nil {
+			return fail(err)
+		}
+		opened = append(opened, s.gatewayLis)
+	}
+
+	store, err := watcher.NewDatastore(cfg.Shell, cfg.Settings)
+	if err != nil {
+		return fail(err)
+	}
+
+	s.store = store
+	s.load = load
+	s.config = cfg
+	s.srv = grpc.NewServer(s.serverOptions()...)
+	if s.metricsLis != nil {
+		s.metrics = NewMetrics(store)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.metrics.Handler())
+		s.metricsSrv = &http.Server{Handler: mux}
+	}
+	token := func() string { return s.Config().Security.Token }
+	if s.browserLis != nil {
+		s.browserSrv = &http.Server{Handler: NewBrowser(store, token).Handler()}
+	}
+	if s.gatewayLis != nil {
+		s.gatewaySrv = &http.Server{Handler: NewGateway(s, token).Handler()}
 	}
 
 	zync.RegisterZyncServer(s.srv, s)
@@ -57,6 +152,9 @@ func (s *Server) HandleTerminate(sig os.Signal) error {
 	switch sig {
 	case syscall.SIGQUIT:
 	case syscall.SIGTERM:
+		if err := Notify("STOPPING=1"); err != nil {
+			log.WithError(err).Warn("could not notify service manager")
+		}
 		return s.Stop()
 	}
 	return nil
@@ -64,17 +162,64 @@ func (s *Server) HandleTerminate(sig os.Signal) error {
 
 // Start launches the gRPC server
 func (s *Server) Start() error {
-	log.Println("grpc server listening...")
+	log.Info("grpc server listening")
+	s.started = time.Now()
 	errs := make(chan error)
 	go func() { errs <- s.store.Start() }()
-	go func() { errs <- s.srv.Serve(s.lis) }()
+	if s.metrics != nil {
+		var ctx context.Context
+		ctx, s.cancel = context.WithCancel(context.Background())
+		go s.metrics.Listen(ctx)
+		log.WithField("address", fmt.Sprintf("http://%s/metrics", s.metricsLis.Addr())).Info("serving metrics")
+		go serveHTTP(s.metricsSrv, s.metricsLis, errs)
+	}
+	scheme := "http"
+	if s.Config().Security.TLSEnabled() {
+		scheme = "https"
+	}
+	if s.browserSrv != nil {
+		log.WithField("address", fmt.Sprintf("%s://%s/", scheme, s.browserLis.Addr())).Info("serving snapshot browser")
+		go serveHTTP(s.browserSrv, s.browserLis, errs)
+	}
+	if s.gatewaySrv != nil {
+		log.WithField("address", fmt.Sprintf("%s://%s/v1/", scheme, s.gatewayLis.Addr())).Info("serving json gateway")
+		go serveHTTP(s.gatewaySrv, s.gatewayLis, errs)
+	}
+	for _, lis := range s.lis {
+		log.WithFields(log.Fields{"network": lis.Addr().Network(), "address": lis.Addr().String()}).Info("listening")
+		go func(lis net.Listener) { errs <- s.srv.Serve(lis) }(lis)
+	}
 	return <-errs
 }
 
+// serveHTTP serves the HTTP server until it is closed, reporting any
+// other error
+func serveHTTP(srv *http.Server, lis net.Listener, errs chan<- error) {
+	if err := srv.Serve(lis); err != http.ErrServerClosed {
+		errs <- err
+	}
+}
+
 // Stop gracefully stops the gRPC server
 func (s *Server) Stop() error {
 	s.srv.GracefulStop()
-	log.Println("grpc server stopped")
+	log.Info("grpc server stopped")
+	if s.metricsSrv != nil {
+		s.cancel()
+		if err := s.metricsSrv.Close(); err != nil {
+			log.WithError(err).Warn("could not stop metrics server")
+		}
+	}
+	if s.browserSrv != nil {
+		if err := s.browserSrv.Close(); err != nil {
+			log.WithError(err).Warn("could not stop snapshot browser")
+		}
+	}
+	if s.gatewaySrv != nil {
+		if err := s.gatewaySrv.Close(); err != nil {
+			log.WithError(err).Warn("could not stop json gateway")
+		}
+	}
 	return s.store.Stop()
 }
 
@@ -101,28 +246,45 @@ func (s *Server) AddFiles(req *zync.RegexRequest, afs zync.Zync_AddFilesServer)
 		return fmt.Errorf("must provide pattern")
 	}
 
-	// received an absolute path
-	if isFilePath(req.Pattern) {
-		file, err := s.store.AddFile(watcher.FilePath(req.Pattern))
+	// received a path to a file, which may be relative to the current
+	// directory
+	path := req.Pattern
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(req.CurrentDirectory, path)
+	}
+	if isFilePath(path) {
+		file, err := s.store.AddFile(watcher.FilePath(path))
 		if err != nil {
 			return err
 		}
-		if err := afs.Send(file.Status()); err != nil {
+		if err := afs.Send(s.store.FileStatus(file)); err != nil {
 			return err
 		}
 	} else {
-		regex, err := regexp.Compile(req.Pattern)
+		m, err := newMatcher(req)
 		if err != nil {
 			return err
 		}
 
-		err = filepath.Walk(req.CurrentDirectory, func(path string, info fs.FileInfo, err error) error {
-			if regex.MatchString(path) {
+		root := walkRoot(req)
+		err = filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				log.WithFields(log.Fields{"path": path, "op": "add"}).WithError(err).Warn("skipping unreadable path")
+				return nil
+			}
+			// ** matches directories too, but only their files are added
+			if info.IsDir() {
+				return nil
+			}
+			if m.match(path) {
 				file, err := s.store.AddFile(watcher.FilePath(path))
 				if err != nil {
 					return err
 				}
-				if err := afs.Send(file.Status()); err != nil {
+				if err := afs.Send(s.store.FileStatus(file)); err != nil {
 					return err
 				}
 			}
@@ -138,79 +300,83 @@ func (s *Server) AddFiles(req *zync.RegexRequest, afs zync.Zync_AddFilesServer)
 // ListFiles lists all files matching the pattern from
 // zync
 func (s *Server) ListFiles(req *zync.RegexRequest, lfs zync.Zync_ListFilesServer) error {
-	var regex *regexp.Regexp
-	if req.Pattern != "" {
-		var err error
-		regex, err = regexp.Compile(req.Pattern)
-		if err != nil {
-			return err
-		}
+	m, err := newMatcher(req)
+	if err != nil {
+		return err
 	}
 
-	var returnErr error
+	var files []*watcher.File
 	s.store.RangeStore(func(file *watcher.File) (done bool) {
-		shouldSend := false
-		if regex != nil {
-			if regex.MatchString(file.AbsolutePath.String()) {
-				shouldSend = true
-			}
-		} else {
-			shouldSend = true
-		}
-		if shouldSend {
-			if err := lfs.Send(file.Status()); err != nil {
-				returnErr = err
-				return true
-			}
+		if m.match(file.AbsolutePath.String()) {
+			files = append(files, file)
 		}
 		return false
 	})
-	if returnErr != nil {
-		return returnErr
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].AbsolutePath < files[j].AbsolutePath
+	})
+
+	for _, file := range files {
+		if err := lfs.Send(s.store.FileStatus(file)); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// DeleteFiles removes all files matching the pattern
-// from zync
+// DeleteFiles removes all files matching the pattern, or
+// the given paths, from zync. A pattern or paths must be
+// given. All of the files are removed in a single commit,
+// so that undo brings all of them back
 func (s *Server) DeleteFiles(req *zync.RegexRequest, dfs zync.Zync_DeleteFilesServer) error {
-	var regex *regexp.Regexp
-	if req.Pattern != "" {
-		var err error
-		regex, err = regexp.Compile(req.Pattern)
+	if req.Pattern == "" && len(req.Paths) == 0 {
+		return fmt.Errorf("must provide pattern")
+	}
+
+	match := func(path string) bool { return false }
+	if len(req.Paths) > 0 {
+		paths := make(map[string]bool, len(req.Paths))
+		for _, path := range req.Paths {
+			paths[path] = true
+		}
+		match = func(path string) bool { return paths[path] }
+	} else {
+		m, err := newMatcher(req)
 		if err != nil {
 			return err
 		}
+		match = m.match
 	}
 
-	filesToRemove := make(map[watcher.FilePath]*watcher.File)
-
-	var returnErr error
+	var files []*watcher.File
 	s.store.RangeStore(func(file *watcher.File) (done bool) {
-		shouldSend := false
-		if regex != nil {
-			if regex.MatchString(file.AbsolutePath.String()) {
-				shouldSend = true
-			}
-		} else {
-			shouldSend = true
-		}
-		if shouldSend {
-			filesToRemove[file.AbsolutePath] = file
+		if match(file.AbsolutePath.String()) {
+			files = append(files, file)
 		}
 		return false
 	})
-	if returnErr != nil {
-		return returnErr
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].AbsolutePath < files[j].AbsolutePath
+	})
+	if req.MaxFiles > 0 && int64(len(files)) > req.MaxFiles {
+		return status.Errorf(codes.FailedPrecondition,
+			"%d files match, more than the maximum of %d", len(files), req.MaxFiles)
 	}
 
-	for path, file := range filesToRemove {
-		log.Printf("removing file %s\n", path)
-		if err := s.store.RemoveFile(path); err != nil {
+	if !req.DryRun {
+		paths := make([]watcher.FilePath, 0, len(files))
+		for _, file := range files {
+			log.WithFields(log.Fields{"path": file.AbsolutePath, "op": "remove"}).Info("removing file")
+			paths = append(paths, file.AbsolutePath)
+		}
+		if err := s.store.RemoveFiles(paths); err != nil {
 			return err
 		}
-		if err := dfs.Send(file.Status()); err != nil {
+	}
+
+	for _, file := range files {
+		if err := dfs.Send(s.store.FileStatus(file)); err != nil {
 			return err
 		}
 	}
@@ -220,13 +386,281 @@ func (s *Server) DeleteFiles(req *zync.RegexRequest, dfs zync.Zync_DeleteFilesSe
 
 // Backup communicates to the server that any cached
 // data should be backed up to IPFS, returning the
-// resulting CID
+// resulting CID. The manifest is kept as a labeled
+// snapshot
 func (s *Server) Backup(ctx context.Context, req *zync.BackupRequest) (*zync.BackupStatus, error) {
-	return nil, fmt.Errorf("TODO")
+	snapshot, err := s.store.Backup(req.Label)
+	if err != nil {
+		return nil, err
+	}
+	return &zync.BackupStatus{
+		Cid:      snapshot.CID.String(),
+		Snapshot: snapshot.Status(),
+	}, nil
+}
+
+// ListSnapshots lists the snapshots taken by Backup or on
+// a schedule that are retained, newest first
+func (s *Server) ListSnapshots(req *zync.ListSnapshotsRequest, lss zync.Zync_ListSnapshotsServer) error {
+	for _, snapshot := range s.store.Snapshots(req.Label) {
+		if err := lss.Send(snapshot.Status()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Restore initiates the process of restoring files
 // from IPFS to the host machine
 func (s *Server) Restore(req *zync.RestoreRequest, rs zync.Zync_RestoreServer) error {
-	return fmt.Errorf("TODO")
+
+	if req.Cid == "" {
+		return fmt.Errorf("must provide cid")
+	}
+
+	cid, err := s.store.ResolveManifest(rs.Context(), req.Cid)
+	if err != nil {
+		return err
+	}
+
+	policy := s.store.Settings().ConflictPolicy
+	if req.ConflictPolicy != "" {
+		policy, err = watcher.ParseConflictPolicy(req.ConflictPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.store.Restore(
+		rs.Context(),
+		cid,
+		policy,
+		func(completed, total int, file *watcher.File, conflict *watcher.Conflict) error {
+			update := &zync.RestoreStatusUpdate{
+				PercentCompleted: float64(completed) / float64(total) * 100,
+				File:             s.store.FileStatus(file),
+			}
+			if conflict != nil {
+				update.Conflict = conflict.Status()
+			}
+			return rs.Send(update)
+		},
+	)
+}
+
+// Undo brings back the files that were removed since a
+// snapshot, by default the last snapshot that held them
+func (s *Server) Undo(req *zync.UndoRequest, us zync.Zync_UndoServer) error {
+	var cid watcher.CID
+	if req.Cid != "" {
+		var err error
+		cid, err = s.store.ResolveManifest(us.Context(), req.Cid)
+		if err != nil {
+			return err
+		}
+	}
+
+	cid, err := s.store.Undo(
+		us.Context(),
+		cid,
+		func(completed, total int, file *watcher.File, conflict *watcher.Conflict) error {
+			update := &zync.RestoreStatusUpdate{
+				PercentCompleted: float64(completed) / float64(total) * 100,
+				File:             s.store.FileStatus(file),
+			}
+			if conflict != nil {
+				update.Conflict = conflict.Status()
+			}
+			return us.Send(update)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"cid": cid, "op": "undo"}).Info("brought back removed files")
+	return nil
+}
+
+// AddTag names a manifest, by default the current one, so
+// it can be referred to by the name instead of its CID
+func (s *Server) AddTag(ctx context.Context, req *zync.AddTagRequest) (*zync.Tag, error) {
+	var cid watcher.CID
+	if req.Cid != "" {
+		var err error
+		cid, err = s.store.ResolveManifest(ctx, req.Cid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tag, err := s.store.AddTag(ctx, req.Name, cid, req.Force)
+	if err != nil {
+		return nil, err
+	}
+	return tag.Status(), nil
+}
+
+// RemoveTag removes a tag, releasing its manifest unless
+// something else still refers to it
+func (s *Server) RemoveTag(ctx context.Context, req *zync.RemoveTagRequest) (*zync.Tag, error) {
+	tag, err := s.store.RemoveTag(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return tag.Status(), nil
+}
+
+// ListTags lists every tag in order of name
+func (s *Server) ListTags(req *zync.ListTagsRequest, lts zync.Zync_ListTagsServer) error {
+	tags, err := s.store.Tags(lts.Context())
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := lts.Send(tag.Status()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListConflicts lists all unresolved conflicts matching
+// the pattern
+func (s *Server) ListConflicts(req *zync.RegexRequest, lcs zync.Zync_ListConflictsServer) error {
+	m, err := newMatcher(req)
+	if err != nil {
+		return err
+	}
+
+	var returnErr error
+	s.store.Conflicts(func(conflict *watcher.Conflict) (done bool) {
+		if m.match(conflict.AbsolutePath.String()) {
+			if err := lcs.Send(conflict.Status()); err != nil {
+				returnErr = err
+				return true
+			}
+		}
+		return false
+	})
+
+	return returnErr
+}
+
+// ResolveConflicts resolves all conflicts matching the
+// pattern using the given policy
+func (s *Server) ResolveConflicts(req *zync.ResolveRequest, rcs zync.Zync_ResolveConflictsServer) error {
+	policy, err := watcher.ParseConflictPolicy(req.Policy)
+	if err != nil {
+		return err
+	}
+
+	m, err := newMatcher(&zync.RegexRequest{
+		Pattern:          req.Pattern,
+		PatternType:      req.PatternType,
+		CurrentDirectory: req.CurrentDirectory,
+		All:              req.All,
+	})
+	if err != nil {
+		return err
+	}
+
+	var paths []watcher.FilePath
+	s.store.Conflicts(func(conflict *watcher.Conflict) (done bool) {
+		if m.match(conflict.AbsolutePath.String()) {
+			paths = append(paths, conflict.AbsolutePath)
+		}
+		return false
+	})
+
+	for _, path := range paths {
+		log.WithFields(log.Fields{"path": path, "policy": policy, "op": "resolve"}).Info("resolving conflict")
+		conflict, err := s.store.ResolveConflict(rcs.Context(), path, policy)
+		if err != nil {
+			return err
+		}
+		if err := rcs.Send(conflict.Status()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WatchEvents streams activity for files matching the
+// pattern as it happens. Commit events are always sent
+func (s *Server) WatchEvents(req *zync.RegexRequest, wes zync.Zync_WatchEventsServer) error {
+	m, err := newMatcher(req)
+	if err != nil {
+		return err
+	}
+
+	for event := range s.store.Subscribe(wes.Context()) {
+		if event.Type == watcher.EventPoll {
+			continue
+		}
+		if event.AbsolutePath != "" && !m.match(event.AbsolutePath.String()) {
+			continue
+		}
+		if err := wes.Send(event.Status()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Status reports the health of the daemon and the state
+// of the files it manages
+func (s *Server) Status(ctx context.Context, req *zync.StatusRequest) (*zync.DaemonStatus, error) {
+	pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	stats := s.store.Stats()
+	cid, _ := s.store.CID()
+	status := &zync.DaemonStatus{
+		Uptime:           durationpb.New(time.Since(s.started)),
+		Backend:          s.store.Settings().Backend,
+		BackendReachable: s.store.Ping(pingCtx) == nil,
+		ManifestCid:      cid.String(),
+		FileCount:        int64(stats.Files),
+		TotalSize:        stats.TotalSize,
+		PendingUploads:   stats.PendingUploads,
+		QueuedRetries:    int64(stats.QueuedRetries),
+	}
+	if !stats.LastCommit.IsZero() {
+		status.LastCommit = timestamppb.New(stats.LastCommit)
+	}
+	for _, fileErr := range stats.Errors {
+		status.Errors = append(status.Errors, fileErr.Status())
+	}
+
+	return status, nil
+}
+
+// Verify checks that every file matching the pattern can
+// be restored from its stored CID
+func (s *Server) Verify(req *zync.RegexRequest, vs zync.Zync_VerifyServer) error {
+	m, err := newMatcher(req)
+	if err != nil {
+		return err
+	}
+
+	var files []*watcher.File
+	s.store.RangeStore(func(file *watcher.File) (done bool) {
+		if m.match(file.AbsolutePath.String()) {
+			files = append(files, file)
+		}
+		return false
+	})
+
+	for _, file := range files {
+		ctx, cancel := context.WithTimeout(vs.Context(), 30*time.Second)
+		verification := s.store.Verify(ctx, file)
+		cancel()
+		if err := vs.Send(verification.Status()); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
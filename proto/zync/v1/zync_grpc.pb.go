@@ -30,16 +30,56 @@ type ZyncClient interface {
 	// ListFiles lists all files matching the pattern from
 	// zync
 	ListFiles(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_ListFilesClient, error)
-	// DeleteFiles removes all files matching the pattern
-	// from zync
+	// DeleteFiles removes all files matching the pattern, or
+	// the given paths, from zync. A pattern or paths must be
+	// given
 	DeleteFiles(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_DeleteFilesClient, error)
 	// Backup communicates to the server that any cached
 	// data should be backed up to IPFS, returning the
-	// resulting CID
+	// resulting CID. The manifest is kept as a labeled
+	// snapshot
 	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (*BackupStatus, error)
+	// ListSnapshots lists the snapshots taken by Backup or on
+	// a schedule that are retained, newest first
+	ListSnapshots(ctx context.Context, in *ListSnapshotsRequest, opts ...grpc.CallOption) (Zync_ListSnapshotsClient, error)
 	// Restore initiates the process of restoring files
 	// from IPFS to the host machine
 	Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (Zync_RestoreClient, error)
+	// ListConflicts lists all unresolved conflicts matching
+	// the pattern
+	ListConflicts(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_ListConflictsClient, error)
+	// ResolveConflicts resolves all conflicts matching the
+	// pattern using the given policy
+	ResolveConflicts(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (Zync_ResolveConflictsClient, error)
+	// WatchEvents streams activity for files matching the
+	// pattern as it happens. Commit events are always sent
+	WatchEvents(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_WatchEventsClient, error)
+	// Status reports the health of the daemon and the state
+	// of the files it manages
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*DaemonStatus, error)
+	// Verify checks that every file matching the pattern can
+	// be restored from its stored CID
+	Verify(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_VerifyClient, error)
+	// Reload re-reads the configuration of the daemon and
+	// applies it without restarting
+	Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*ReloadStatus, error)
+	// Export writes the snapshot held at a manifest CID as a
+	// tar or CAR archive, streamed in chunks
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (Zync_ExportClient, error)
+	// Import uploads the contents of a tar or CAR archive,
+	// streamed in chunks, returning the resulting snapshot
+	Import(ctx context.Context, opts ...grpc.CallOption) (Zync_ImportClient, error)
+	// Undo brings back the files that were removed since a
+	// snapshot, by default the last snapshot that held them
+	Undo(ctx context.Context, in *UndoRequest, opts ...grpc.CallOption) (Zync_UndoClient, error)
+	// AddTag names a manifest, by default the current one, so
+	// it can be referred to by the name instead of its CID
+	AddTag(ctx context.Context, in *AddTagRequest, opts ...grpc.CallOption) (*Tag, error)
+	// RemoveTag removes a tag, releasing its manifest unless
+	// something else still refers to it
+	RemoveTag(ctx context.Context, in *RemoveTagRequest, opts ...grpc.CallOption) (*Tag, error)
+	// ListTags lists every tag in order of name
+	ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (Zync_ListTagsClient, error)
 }
 
 type zyncClient struct {
@@ -155,8 +195,40 @@ func (c *zyncClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc
 	return out, nil
 }
 
+func (c *zyncClient) ListSnapshots(ctx context.Context, in *ListSnapshotsRequest, opts ...grpc.CallOption) (Zync_ListSnapshotsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[3], "/zync.v1.zync/ListSnapshots", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncListSnapshotsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_ListSnapshotsClient interface {
+	Recv() (*Snapshot, error)
+	grpc.ClientStream
+}
+
+type zyncListSnapshotsClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncListSnapshotsClient) Recv() (*Snapshot, error) {
+	m := new(Snapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *zyncClient) Restore(ctx context.Context, in *RestoreRequest, opts ...grpc.CallOption) (Zync_RestoreClient, error) {
-	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[3], "/zync.v1.zync/Restore", opts...)
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[4], "/zync.v1.zync/Restore", opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -187,6 +259,300 @@ func (x *zyncRestoreClient) Recv() (*RestoreStatusUpdate, error) {
 	return m, nil
 }
 
+func (c *zyncClient) ListConflicts(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_ListConflictsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[5], "/zync.v1.zync/ListConflicts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncListConflictsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_ListConflictsClient interface {
+	Recv() (*Conflict, error)
+	grpc.ClientStream
+}
+
+type zyncListConflictsClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncListConflictsClient) Recv() (*Conflict, error) {
+	m := new(Conflict)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zyncClient) ResolveConflicts(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (Zync_ResolveConflictsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[6], "/zync.v1.zync/ResolveConflicts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncResolveConflictsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_ResolveConflictsClient interface {
+	Recv() (*Conflict, error)
+	grpc.ClientStream
+}
+
+type zyncResolveConflictsClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncResolveConflictsClient) Recv() (*Conflict, error) {
+	m := new(Conflict)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zyncClient) WatchEvents(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[7], "/zync.v1.zync/WatchEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_WatchEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type zyncWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncWatchEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zyncClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*DaemonStatus, error) {
+	out := new(DaemonStatus)
+	err := c.cc.Invoke(ctx, "/zync.v1.zync/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zyncClient) Verify(ctx context.Context, in *RegexRequest, opts ...grpc.CallOption) (Zync_VerifyClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[8], "/zync.v1.zync/Verify", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncVerifyClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_VerifyClient interface {
+	Recv() (*Verification, error)
+	grpc.ClientStream
+}
+
+type zyncVerifyClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncVerifyClient) Recv() (*Verification, error) {
+	m := new(Verification)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zyncClient) Reload(ctx context.Context, in *ReloadRequest, opts ...grpc.CallOption) (*ReloadStatus, error) {
+	out := new(ReloadStatus)
+	err := c.cc.Invoke(ctx, "/zync.v1.zync/Reload", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zyncClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (Zync_ExportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[9], "/zync.v1.zync/Export", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncExportClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_ExportClient interface {
+	Recv() (*ArchiveChunk, error)
+	grpc.ClientStream
+}
+
+type zyncExportClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncExportClient) Recv() (*ArchiveChunk, error) {
+	m := new(ArchiveChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zyncClient) Import(ctx context.Context, opts ...grpc.CallOption) (Zync_ImportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[10], "/zync.v1.zync/Import", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncImportClient{stream}
+	return x, nil
+}
+
+type Zync_ImportClient interface {
+	Send(*ImportRequest) error
+	CloseAndRecv() (*ImportStatus, error)
+	grpc.ClientStream
+}
+
+type zyncImportClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncImportClient) Send(m *ImportRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *zyncImportClient) CloseAndRecv() (*ImportStatus, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zyncClient) Undo(ctx context.Context, in *UndoRequest, opts ...grpc.CallOption) (Zync_UndoClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[11], "/zync.v1.zync/Undo", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncUndoClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_UndoClient interface {
+	Recv() (*RestoreStatusUpdate, error)
+	grpc.ClientStream
+}
+
+type zyncUndoClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncUndoClient) Recv() (*RestoreStatusUpdate, error) {
+	m := new(RestoreStatusUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zyncClient) AddTag(ctx context.Context, in *AddTagRequest, opts ...grpc.CallOption) (*Tag, error) {
+	out := new(Tag)
+	err := c.cc.Invoke(ctx, "/zync.v1.zync/AddTag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zyncClient) RemoveTag(ctx context.Context, in *RemoveTagRequest, opts ...grpc.CallOption) (*Tag, error) {
+	out := new(Tag)
+	err := c.cc.Invoke(ctx, "/zync.v1.zync/RemoveTag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zyncClient) ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (Zync_ListTagsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zync_ServiceDesc.Streams[12], "/zync.v1.zync/ListTags", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zyncListTagsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zync_ListTagsClient interface {
+	Recv() (*Tag, error)
+	grpc.ClientStream
+}
+
+type zyncListTagsClient struct {
+	grpc.ClientStream
+}
+
+func (x *zyncListTagsClient) Recv() (*Tag, error) {
+	m := new(Tag)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ZyncServer is the server API for Zync service.
 // All implementations must embed UnimplementedZyncServer
 // for forward compatibility
@@ -199,16 +565,56 @@ type ZyncServer interface {
 	// ListFiles lists all files matching the pattern from
 	// zync
 	ListFiles(*RegexRequest, Zync_ListFilesServer) error
-	// DeleteFiles removes all files matching the pattern
-	// from zync
+	// DeleteFiles removes all files matching the pattern, or
+	// the given paths, from zync. A pattern or paths must be
+	// given
 	DeleteFiles(*RegexRequest, Zync_DeleteFilesServer) error
 	// Backup communicates to the server that any cached
 	// data should be backed up to IPFS, returning the
-	// resulting CID
+	// resulting CID. The manifest is kept as a labeled
+	// snapshot
 	Backup(context.Context, *BackupRequest) (*BackupStatus, error)
+	// ListSnapshots lists the snapshots taken by Backup or on
+	// a schedule that are retained, newest first
+	ListSnapshots(*ListSnapshotsRequest, Zync_ListSnapshotsServer) error
 	// Restore initiates the process of restoring files
 	// from IPFS to the host machine
 	Restore(*RestoreRequest, Zync_RestoreServer) error
+	// ListConflicts lists all unresolved conflicts matching
+	// the pattern
+	ListConflicts(*RegexRequest, Zync_ListConflictsServer) error
+	// ResolveConflicts resolves all conflicts matching the
+	// pattern using the given policy
+	ResolveConflicts(*ResolveRequest, Zync_ResolveConflictsServer) error
+	// WatchEvents streams activity for files matching the
+	// pattern as it happens. Commit events are always sent
+	WatchEvents(*RegexRequest, Zync_WatchEventsServer) error
+	// Status reports the health of the daemon and the state
+	// of the files it manages
+	Status(context.Context, *StatusRequest) (*DaemonStatus, error)
+	// Verify checks that every file matching the pattern can
+	// be restored from its stored CID
+	Verify(*RegexRequest, Zync_VerifyServer) error
+	// Reload re-reads the configuration of the daemon and
+	// applies it without restarting
+	Reload(context.Context, *ReloadRequest) (*ReloadStatus, error)
+	// Export writes the snapshot held at a manifest CID as a
+	// tar or CAR archive, streamed in chunks
+	Export(*ExportRequest, Zync_ExportServer) error
+	// Import uploads the contents of a tar or CAR archive,
+	// streamed in chunks, returning the resulting snapshot
+	Import(Zync_ImportServer) error
+	// Undo brings back the files that were removed since a
+	// snapshot, by default the last snapshot that held them
+	Undo(*UndoRequest, Zync_UndoServer) error
+	// AddTag names a manifest, by default the current one, so
+	// it can be referred to by the name instead of its CID
+	AddTag(context.Context, *AddTagRequest) (*Tag, error)
+	// RemoveTag removes a tag, releasing its manifest unless
+	// something else still refers to it
+	RemoveTag(context.Context, *RemoveTagRequest) (*Tag, error)
+	// ListTags lists every tag in order of name
+	ListTags(*ListTagsRequest, Zync_ListTagsServer) error
 	mustEmbedUnimplementedZyncServer()
 }
 
@@ -228,9 +634,48 @@ func (UnimplementedZyncServer) DeleteFiles(*RegexRequest, Zync_DeleteFilesServer
 func (UnimplementedZyncServer) Backup(context.Context, *BackupRequest) (*BackupStatus, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Backup not implemented")
 }
+func (UnimplementedZyncServer) ListSnapshots(*ListSnapshotsRequest, Zync_ListSnapshotsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListSnapshots not implemented")
+}
 func (UnimplementedZyncServer) Restore(*RestoreRequest, Zync_RestoreServer) error {
 	return status.Errorf(codes.Unimplemented, "method Restore not implemented")
 }
+func (UnimplementedZyncServer) ListConflicts(*RegexRequest, Zync_ListConflictsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListConflicts not implemented")
+}
+func (UnimplementedZyncServer) ResolveConflicts(*ResolveRequest, Zync_ResolveConflictsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ResolveConflicts not implemented")
+}
+func (UnimplementedZyncServer) WatchEvents(*RegexRequest, Zync_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedZyncServer) Status(context.Context, *StatusRequest) (*DaemonStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedZyncServer) Verify(*RegexRequest, Zync_VerifyServer) error {
+	return status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedZyncServer) Reload(context.Context, *ReloadRequest) (*ReloadStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Reload not implemented")
+}
+func (UnimplementedZyncServer) Export(*ExportRequest, Zync_ExportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedZyncServer) Import(Zync_ImportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Import not implemented")
+}
+func (UnimplementedZyncServer) Undo(*UndoRequest, Zync_UndoServer) error {
+	return status.Errorf(codes.Unimplemented, "method Undo not implemented")
+}
+func (UnimplementedZyncServer) AddTag(context.Context, *AddTagRequest) (*Tag, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddTag not implemented")
+}
+func (UnimplementedZyncServer) RemoveTag(context.Context, *RemoveTagRequest) (*Tag, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveTag not implemented")
+}
+func (UnimplementedZyncServer) ListTags(*ListTagsRequest, Zync_ListTagsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListTags not implemented")
+}
 func (UnimplementedZyncServer) mustEmbedUnimplementedZyncServer() {}
 
 // UnsafeZyncServer may be embedded to opt out of forward compatibility for this service.
@@ -325,6 +770,27 @@ func _Zync_Backup_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Zync_ListSnapshots_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListSnapshotsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).ListSnapshots(m, &zyncListSnapshotsServer{stream})
+}
+
+type Zync_ListSnapshotsServer interface {
+	Send(*Snapshot) error
+	grpc.ServerStream
+}
+
+type zyncListSnapshotsServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncListSnapshotsServer) Send(m *Snapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Zync_Restore_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(RestoreRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -346,6 +812,251 @@ func (x *zyncRestoreServer) Send(m *RestoreStatusUpdate) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Zync_ListConflicts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RegexRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).ListConflicts(m, &zyncListConflictsServer{stream})
+}
+
+type Zync_ListConflictsServer interface {
+	Send(*Conflict) error
+	grpc.ServerStream
+}
+
+type zyncListConflictsServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncListConflictsServer) Send(m *Conflict) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zync_ResolveConflicts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ResolveRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).ResolveConflicts(m, &zyncResolveConflictsServer{stream})
+}
+
+type Zync_ResolveConflictsServer interface {
+	Send(*Conflict) error
+	grpc.ServerStream
+}
+
+type zyncResolveConflictsServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncResolveConflictsServer) Send(m *Conflict) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zync_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RegexRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).WatchEvents(m, &zyncWatchEventsServer{stream})
+}
+
+type Zync_WatchEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type zyncWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncWatchEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zync_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZyncServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zync.v1.zync/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZyncServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zync_Verify_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RegexRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).Verify(m, &zyncVerifyServer{stream})
+}
+
+type Zync_VerifyServer interface {
+	Send(*Verification) error
+	grpc.ServerStream
+}
+
+type zyncVerifyServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncVerifyServer) Send(m *Verification) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zync_Reload_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZyncServer).Reload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zync.v1.zync/Reload",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZyncServer).Reload(ctx, req.(*ReloadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zync_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).Export(m, &zyncExportServer{stream})
+}
+
+type Zync_ExportServer interface {
+	Send(*ArchiveChunk) error
+	grpc.ServerStream
+}
+
+type zyncExportServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncExportServer) Send(m *ArchiveChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zync_Import_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ZyncServer).Import(&zyncImportServer{stream})
+}
+
+type Zync_ImportServer interface {
+	SendAndClose(*ImportStatus) error
+	Recv() (*ImportRequest, error)
+	grpc.ServerStream
+}
+
+type zyncImportServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncImportServer) SendAndClose(m *ImportStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *zyncImportServer) Recv() (*ImportRequest, error) {
+	m := new(ImportRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Zync_Undo_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(UndoRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).Undo(m, &zyncUndoServer{stream})
+}
+
+type Zync_UndoServer interface {
+	Send(*RestoreStatusUpdate) error
+	grpc.ServerStream
+}
+
+type zyncUndoServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncUndoServer) Send(m *RestoreStatusUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zync_AddTag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddTagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZyncServer).AddTag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zync.v1.zync/AddTag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZyncServer).AddTag(ctx, req.(*AddTagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zync_RemoveTag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveTagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZyncServer).RemoveTag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zync.v1.zync/RemoveTag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZyncServer).RemoveTag(ctx, req.(*RemoveTagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zync_ListTags_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListTagsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZyncServer).ListTags(m, &zyncListTagsServer{stream})
+}
+
+type Zync_ListTagsServer interface {
+	Send(*Tag) error
+	grpc.ServerStream
+}
+
+type zyncListTagsServer struct {
+	grpc.ServerStream
+}
+
+func (x *zyncListTagsServer) Send(m *Tag) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Zync_ServiceDesc is the grpc.ServiceDesc for Zync service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -357,6 +1068,22 @@ var Zync_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Backup",
 			Handler:    _Zync_Backup_Handler,
 		},
+		{
+			MethodName: "Status",
+			Handler:    _Zync_Status_Handler,
+		},
+		{
+			MethodName: "Reload",
+			Handler:    _Zync_Reload_Handler,
+		},
+		{
+			MethodName: "AddTag",
+			Handler:    _Zync_AddTag_Handler,
+		},
+		{
+			MethodName: "RemoveTag",
+			Handler:    _Zync_RemoveTag_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -374,11 +1101,56 @@ var Zync_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Zync_DeleteFiles_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ListSnapshots",
+			Handler:       _Zync_ListSnapshots_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "Restore",
 			Handler:       _Zync_Restore_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ListConflicts",
+			Handler:       _Zync_ListConflicts_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ResolveConflicts",
+			Handler:       _Zync_ResolveConflicts_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Zync_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Verify",
+			Handler:       _Zync_Verify_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Export",
+			Handler:       _Zync_Export_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Import",
+			Handler:       _Zync_Import_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Undo",
+			Handler:       _Zync_Undo_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListTags",
+			Handler:       _Zync_ListTags_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "zync.proto",
 }
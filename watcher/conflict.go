@@ -0,0 +1,81 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ConflictPolicy decides which version of a file is kept when the
+// local copy disagrees with the copy recorded in a manifest
+type ConflictPolicy string
+
+const (
+	// PreferLocal keeps the local file and uploads it
+	PreferLocal ConflictPolicy = "prefer-local"
+	// PreferRemote replaces the local file with the manifest copy
+	PreferRemote ConflictPolicy = "prefer-remote"
+	// KeepBoth keeps the local file and writes the manifest copy
+	// next to it with a suffixed name
+	KeepBoth ConflictPolicy = "keep-both"
+	// Ask leaves both versions untouched and records the conflict
+	// so that it can be resolved later
+	Ask ConflictPolicy = "ask"
+)
+
+// ParseConflictPolicy validates the given policy name
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(name); policy {
+	case PreferLocal, PreferRemote, KeepBoth, Ask:
+		return policy, nil
+	}
+	return "", fmt.Errorf(
+		"unknown conflict policy %q. must be one of %s, %s, %s or %s",
+		name,
+		PreferLocal,
+		PreferRemote,
+		KeepBoth,
+		Ask,
+	)
+}
+
+func (p ConflictPolicy) String() string {
+	return string(p)
+}
+
+// Conflict records a file whose local contents disagree with the
+// contents recorded in a manifest
+type Conflict struct {
+	AbsolutePath FilePath
+	LocalCID     CID
+	RemoteCID    CID
+	DetectedAt   time.Time
+	Resolution   ConflictPolicy
+}
+
+// CopyPath returns the path the remote version of the file is written
+// to when both versions are kept
+func (c *Conflict) CopyPath() FilePath {
+	path := c.AbsolutePath.String()
+	ext := filepath.Ext(path)
+	suffix := c.RemoteCID.String()
+	if len(suffix) > 8 {
+		suffix = suffix[:8]
+	}
+	return FilePath(fmt.Sprintf("%s.conflict-%s%s", strings.TrimSuffix(path, ext), suffix, ext))
+}
+
+// Status returns the RPC format for the Conflict
+func (c *Conflict) Status() *zync.Conflict {
+	return &zync.Conflict{
+		AbsolutePath: c.AbsolutePath.String(),
+		LocalCid:     c.LocalCID.String(),
+		RemoteCid:    c.RemoteCID.String(),
+		DetectedAt:   timestamppb.New(c.DetectedAt),
+		Resolution:   c.Resolution.String(),
+	}
+}
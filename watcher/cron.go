@@ -0,0 +1,234 @@
+package watcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearch bounds how far ahead the next time of a cron expression is
+// searched for, which covers every valid expression
+const cronSearch = 5 * 366 * 24 * time.Hour
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// cronField describes the values a field of a cron expression may hold
+type cronField struct {
+	name     string
+	min, max int
+	// names are accepted in place of the values from min onwards
+	names []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: monthNames},
+	// 7 is also sunday
+	{name: "day of week", min: 0, max: 7, names: dayNames},
+}
+
+// Cron is a standard five field cron expression: minute, hour, day of
+// month, month and day of week. Fields hold *, values, ranges like 1-5
+// and lists like 1,15, each optionally stepped like */15. Months and
+// days of the week may be named, and @hourly, @daily, @weekly, @monthly
+// and @yearly are accepted. Like cron, a time matches when either day
+// field matches if both are restricted
+type Cron struct {
+	expr string
+	// each field is a set of bits, one per value
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny, hourAny       bool
+}
+
+// ParseCron parses a cron expression
+func ParseCron(expr string) (*Cron, error) {
+	spec := strings.TrimSpace(expr)
+	if descriptor, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields", expr, len(cronFields))
+	}
+
+	c := &Cron{expr: expr}
+	sets := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, field := range fields {
+		set, err := cronFields[i].parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+		*sets[i] = set
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	c.hourAny = c.hour == 1<<24-1
+
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return c, nil
+}
+
+func (f cronField) parse(field string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s", part[i+1:], f.name)
+			}
+			part = part[:i]
+		}
+
+		var low, high int
+		switch {
+		case part == "*":
+			low, high = f.min, f.max
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if high, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q in %s", part, f.name)
+			}
+		default:
+			var err error
+			if low, err = f.value(part); err != nil {
+				return 0, err
+			}
+			high = low
+			// like cron, a stepped value runs to the end of the field
+			if step > 1 {
+				high = f.max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, must be from %d to %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t that matches the expression, or
+// the zero time if there is none. Like cron, expressions restricted to
+// certain hours match once when the clocks are set back, and a time
+// skipped when the clocks are set forward matches once they have been
+func (c *Cron) Next(t time.Time) time.Time {
+	limit := t.Add(cronSearch)
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			next = date(t.Year(), t.Month()+1, 1, 0, loc)
+		case !c.dayMatches(t):
+			next = date(t.Year(), t.Month(), t.Day()+1, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			next = date(t.Year(), t.Month(), t.Day(), t.Hour()+1, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0, !c.hourAny && repeated(t):
+			next = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+
+		// the wall clock moved further than the time that passed when
+		// the clocks were set forward, skipping the times just before next
+		if skipped := wall(next).Sub(wall(t)) - next.Sub(t); skipped > 0 && !c.hourAny {
+			for w := wall(next).Add(-skipped); w.Before(wall(next)); w = w.Add(time.Minute) {
+				if c.matches(w) {
+					return next
+				}
+			}
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matches(t time.Time) bool {
+	return c.month&(1<<uint(t.Month())) != 0 && c.dayMatches(t) &&
+		c.hour&(1<<uint(t.Hour())) != 0 && c.minute&(1<<uint(t.Minute())) != 0
+}
+
+// date returns the start of the hour in loc, or the time the clocks were
+// set forward to when they skipped it. time.Date would move a skipped
+// hour backwards instead, which Next would keep returning to
+func date(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	if want := time.Date(year, month, day, hour, 0, 0, 0, time.UTC); wall(t).Before(want) {
+		t = t.Add(want.Sub(wall(t)))
+	}
+	return t
+}
+
+// wall returns the time shown by the wall clock at t, as a time in UTC
+func wall(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+// repeated reports whether the wall clock already showed the time of t
+// before the clocks were set back
+func repeated(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	return wall(t.Add(-time.Duration(before-offset) * time.Second)).Equal(wall(t))
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// String returns the expression as it was given
+func (c *Cron) String() string {
+	return c.expr
+}
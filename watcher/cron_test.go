@@ -0,0 +1,212 @@
+package watcher
+
+import (
+	"strings"
+	"testing"
+	"time"
+	// the zone database is embedded so the daylight saving tests run
+	// wherever the system lacks one
+	_ "time/tzdata"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "", want: "must have 5 fields"},
+		{expr: "* * * *", want: "must have 5 fields"},
+		{expr: "* * * * * *", want: "must have 5 fields"},
+		{expr: "@fortnightly", want: "must have 5 fields"},
+		{expr: "60 * * * *", want: "invalid minute"},
+		{expr: "-1 * * * *", want: "invalid minute"},
+		{expr: "* 24 * * *", want: "invalid hour"},
+		{expr: "* * 0 * *", want: "invalid day of month"},
+		{expr: "* * 32 * *", want: "invalid day of month"},
+		{expr: "* * * 13 *", want: "invalid month"},
+		{expr: "* * * smarch *", want: "invalid month"},
+		{expr: "* * * * 8", want: "invalid day of week"},
+		{expr: "* * * * funday", want: "invalid day of week"},
+		{expr: "*/0 * * * *", want: "invalid step"},
+		{expr: "*/-5 * * * *", want: "invalid step"},
+		{expr: "*/x * * * *", want: "invalid step"},
+		{expr: "30-10 * * * *", want: "invalid range"},
+		{expr: "fri-mon * * * *", want: "invalid minute"},
+		{expr: "0 0 1-5,x * *", want: "invalid day of month"},
+		{expr: "0 0 30 feb *", want: "never matches"},
+		{expr: "0 0 31 apr,jun,sep,nov *", want: "never matches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if err == nil {
+				t.Fatalf("ParseCron(%q) succeeded, want an error", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseCron(%q) = %v, want an error containing %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// in New York clocks are set forward from 02:00 to 03:00 on 8 March
+	// 2026, and back from 02:00 to 01:00 on 1 November 2026
+
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from string
+		// want lists the times that follow from, in order
+		want []string
+	}{
+		{
+			name: "next minute",
+			expr: "* * * * *",
+			from: "2026-05-04T10:15:30Z",
+			want: []string{"2026-05-04T10:16:00Z", "2026-05-04T10:17:00Z"},
+		},
+		{
+			name: "steps",
+			expr: "*/20 9-17/4 * * *",
+			from: "2026-05-04T13:40:00Z",
+			want: []string{"2026-05-04T17:00:00Z", "2026-05-04T17:20:00Z", "2026-05-04T17:40:00Z", "2026-05-05T09:00:00Z"},
+		},
+		{
+			name: "end of month",
+			expr: "0 12 * * *",
+			from: "2026-04-30T13:00:00Z",
+			want: []string{"2026-05-01T12:00:00Z"},
+		},
+		{
+			name: "end of year",
+			expr: "@hourly",
+			from: "2026-12-31T23:59:00Z",
+			want: []string{"2027-01-01T00:00:00Z", "2027-01-01T01:00:00Z"},
+		},
+		{
+			name: "yearly",
+			expr: "@yearly",
+			from: "2026-01-01T00:00:00Z",
+			want: []string{"2027-01-01T00:00:00Z", "2028-01-01T00:00:00Z"},
+		},
+		{
+			name: "31st skips short months",
+			expr: "0 0 31 * *",
+			from: "2026-01-31T00:00:00Z",
+			want: []string{"2026-03-31T00:00:00Z", "2026-05-31T00:00:00Z", "2026-07-31T00:00:00Z"},
+		},
+		{
+			name: "29 february waits for a leap year",
+			expr: "0 0 29 2 *",
+			from: "2026-03-01T00:00:00Z",
+			want: []string{"2028-02-29T00:00:00Z", "2032-02-29T00:00:00Z"},
+		},
+		{
+			name: "named months and days",
+			expr: "0 8 * jun-aug sat,sun",
+			from: "2026-05-30T09:00:00Z",
+			want: []string{"2026-06-06T08:00:00Z", "2026-06-07T08:00:00Z", "2026-06-13T08:00:00Z"},
+		},
+		{
+			name: "sunday as 7",
+			expr: "0 0 * * 7",
+			from: "2026-05-04T00:00:00Z",
+			want: []string{"2026-05-10T00:00:00Z"},
+		},
+		{
+			name: "day of month or day of week when both are restricted",
+			expr: "0 0 13 * fri",
+			from: "2026-02-01T00:00:00Z",
+			want: []string{"2026-02-06T00:00:00Z", "2026-02-13T00:00:00Z", "2026-02-20T00:00:00Z", "2026-02-27T00:00:00Z", "2026-03-06T00:00:00Z", "2026-03-13T00:00:00Z"},
+		},
+		{
+			name: "day of month only when day of week is any",
+			expr: "0 0 13 * *",
+			from: "2026-02-01T00:00:00Z",
+			want: []string{"2026-02-13T00:00:00Z", "2026-03-13T00:00:00Z"},
+		},
+		{
+			name: "day of week only when day of month is any",
+			expr: "0 0 * * fri",
+			from: "2026-02-01T00:00:00Z",
+			want: []string{"2026-02-06T00:00:00Z", "2026-02-13T00:00:00Z"},
+		},
+		{
+			name: "day of week within a month",
+			expr: "0 0 1 6 mon",
+			from: "2026-05-01T00:00:00Z",
+			want: []string{"2026-06-01T00:00:00Z", "2026-06-08T00:00:00Z", "2026-06-15T00:00:00Z"},
+		},
+		{
+			name: "daily across the clocks being set forward",
+			expr: "0 4 * * *",
+			loc:  newYork,
+			from: "2026-03-07T05:00:00-05:00",
+			want: []string{"2026-03-08T04:00:00-04:00", "2026-03-09T04:00:00-04:00"},
+		},
+		{
+			name: "time skipped by daylight saving matches once the clocks are set forward",
+			expr: "30 2 * * *",
+			loc:  newYork,
+			from: "2026-03-07T03:00:00-05:00",
+			want: []string{"2026-03-08T03:00:00-04:00", "2026-03-09T02:30:00-04:00"},
+		},
+		{
+			name: "hourly across the clocks being set forward",
+			expr: "30 * * * *",
+			loc:  newYork,
+			from: "2026-03-08T01:00:00-05:00",
+			want: []string{"2026-03-08T01:30:00-05:00", "2026-03-08T03:30:00-04:00"},
+		},
+		{
+			name: "repeated time matches once when the clocks are set back",
+			expr: "30 1 * * *",
+			loc:  newYork,
+			from: "2026-10-31T12:00:00-04:00",
+			want: []string{"2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		},
+		{
+			name: "hourly across the clocks being set back",
+			expr: "30 * * * *",
+			loc:  newYork,
+			from: "2026-11-01T00:45:00-04:00",
+			want: []string{"2026-11-01T01:30:00-04:00", "2026-11-01T01:30:00-05:00", "2026-11-01T02:30:00-05:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			next := parseTime(t, tt.from).In(loc)
+			for _, s := range tt.want {
+				want := parseTime(t, s)
+				prev := next
+				next = c.Next(prev)
+				if !next.Equal(want) {
+					t.Fatalf("Next(%s) = %s, want %s", prev.Format(time.RFC3339), next.Format(time.RFC3339), want.Format(time.RFC3339))
+				}
+			}
+		})
+	}
+}
+
+func parseTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
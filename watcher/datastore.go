@@ -3,25 +3,62 @@ package watcher
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	shell "github.com/ipfs/go-ipfs-api"
 	wraperr "github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 type store map[FilePath]*File
 
+// Settings configures the behavior of a Datastore
+type Settings struct {
+	// BackupLocation is the file the latest manifest CID is written to
+	BackupLocation string
+	// RefreshInterval is how often watched files are checked for changes
+	RefreshInterval time.Duration
+	// ConflictPolicy decides how disagreements between local files and
+	// a manifest are resolved
+	ConflictPolicy ConflictPolicy
+	// Follow lists the names of manifests published by other devices
+	// whose changes are applied locally
+	Follow []string
+	// Backend describes the IPFS API the datastore talks to
+	Backend string
+	// FollowInterval is how often followed manifests are checked for changes
+	FollowInterval time.Duration
+	// DeleteRemoved deletes files from disk when a followed device
+	// removes them. Otherwise they are only no longer tracked
+	DeleteRemoved bool
+	// Names publishes every committed manifest CID when set
+	Names Names
+	// Broker announces committed manifests to, and receives announcements
+	// from, other devices on Topic when set
+	Broker Broker
+	Topic  string
+	// Schedules take labeled snapshots and decide how long they are
+	// retained
+	Schedules []Schedule
+}
+
 // Datastore wraps a distributed datastore like IPFS, but keeps
 // all watched files up to date
 type Datastore struct {
+	// uploading counts uploads in progress. It is accessed atomically
+	// and kept first for 64-bit alignment
+	uploading int64
 	// handles
 	sh    *shell.Shell
 	store store
@@ -29,18 +66,32 @@ type Datastore struct {
 	errs      chan error
 	additions chan FilePath
 	removals  chan FilePath
+	published chan CID
 	stop      chan struct{}
 	// state
-	cid CID
+	cid         CID
+	committedAt time.Time
+	conflicts   map[FilePath]*Conflict
+	remotes     map[string]*remote
+	failures    map[FilePath]*FileError
+	history     []Snapshot
+	snapshots   []Snapshot
+	manifests   map[CID]store
 	// settings
-	backupLocation      string
-	fileRefreshInterval time.Duration
+	settings   Settings
+	following  chan struct{}
+	scheduling chan struct{}
+	// subscriptions
+	events events
 	// synchronization
-	mux sync.RWMutex
+	mux         sync.RWMutex
+	syncMux     sync.Mutex
+	settingsMux sync.RWMutex
+	tagsMux     sync.Mutex
 }
 
 // NewDatastore constructs a datastore with the given settings
-func NewDatastore(sh *shell.Shell, backupLocation string, refreshInterval time.Duration) (*Datastore, error) {
+func NewDatastore(sh *shell.Shell, settings Settings) (*Datastore, error) {
 	datastore := &Datastore{
 		// handles
 		sh:    sh,
@@ -50,22 +101,35 @@ func NewDatastore(sh *shell.Shell, backupLocation string, refreshInterval time.D
 		stop:      make(chan struct{}),
 		additions: make(chan FilePath),
 		removals:  make(chan FilePath),
+		published: make(chan CID, 1),
+		// state
+		conflicts: make(map[FilePath]*Conflict),
+		remotes:   make(map[string]*remote),
+		failures:  make(map[FilePath]*FileError),
+		manifests: make(map[CID]store),
 		// settings
-		backupLocation:      backupLocation,
-		fileRefreshInterval: refreshInterval,
+		settings: settings,
+	}
+
+	if err := datastore.loadHistory(); err != nil {
+		return nil, err
+	}
+	if err := datastore.loadSnapshots(); err != nil {
+		return nil, err
 	}
 
-	cidBytes, err := ioutil.ReadFile(backupLocation)
+	cidBytes, err := ioutil.ReadFile(settings.BackupLocation)
 	if err == nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		data, err := cat(ctx, sh, string(cidBytes))
 		if err != nil {
-			log.Printf("could not retrieve previous cid: %+v\n", err)
-			log.Println("creating store from scratch")
+			log.WithFields(log.Fields{"cid": string(cidBytes), "op": "load"}).WithError(err).
+				Warn("could not retrieve previous manifest, creating store from scratch")
 			return datastore, nil
 		}
 
+		datastore.UpdateCID(CID(cidBytes))
 		err = datastore.FromJSON(data)
 		if err != nil {
 			return nil, err
@@ -80,6 +144,12 @@ func NewDatastore(sh *shell.Shell, backupLocation string, refreshInterval time.D
 func (d *Datastore) Start() error {
 	go d.listenAdditions(d.additions)
 	go d.listenRemovals(d.removals)
+	go d.listenPublishes(d.published)
+	go d.listenRetries()
+	d.settingsMux.Lock()
+	d.following = d.follow(d.settings)
+	d.scheduling = d.schedule(d.settings)
+	d.settingsMux.Unlock()
 	select {
 	case err := <-d.errs:
 		return err
@@ -97,32 +167,37 @@ func (d *Datastore) Stop() error {
 		}
 	}
 	d.mux.RUnlock()
-	d.stop <- struct{}{}
+	close(d.stop)
 	return nil
 }
 
 func (d *Datastore) listenAdditions(newFiles chan FilePath) {
 	for {
 		path := <-newFiles
-		_, err := d.AddFile(path)
-		if err != nil {
-			d.errs <- err
+		if _, err := d.AddFile(path); err != nil {
+			d.fail(path, err)
+			continue
 		}
+		d.succeed(path)
 	}
 }
 
 func (d *Datastore) listenRemovals(removedFiles chan FilePath) {
 	for {
-		err := d.RemoveFile(<-removedFiles)
-		if err != nil {
-			d.errs <- err
+		path := <-removedFiles
+		if err := d.RemoveFile(path); err != nil {
+			d.fail(path, err)
+			continue
 		}
+		d.succeed(path)
 	}
 }
 
+// RemoveFile stops watching the file at the given path and removes it
+// from the datastore
 func (d *Datastore) RemoveFile(path FilePath) error {
 	if path != "" {
-		delete(d.store, path)
+		d.untrack(path)
 		if err := d.commit(); err != nil {
 			return err
 		}
@@ -130,6 +205,19 @@ func (d *Datastore) RemoveFile(path FilePath) error {
 	return nil
 }
 
+// RemoveFiles stops watching the files at the given paths and removes
+// them from the datastore, committing once so that the previous snapshot
+// holds all of them
+func (d *Datastore) RemoveFiles(paths []FilePath) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	for _, path := range paths {
+		d.untrack(path)
+	}
+	return d.commit()
+}
+
 // AddFile adds the file at the given path to the datastore
 func (d *Datastore) AddFile(path FilePath) (*File, error) {
 
@@ -149,40 +237,115 @@ func (d *Datastore) AddFile(path FilePath) (*File, error) {
 		file = f
 	}
 
-	b, err := file.Read()
-	if err != nil {
-		return nil, err
+	if err := d.upload(file); err != nil {
+		return file, err
+	}
+
+	d.mux.Lock()
+	d.store[file.AbsolutePath] = file
+	d.mux.Unlock()
+
+	if err := d.commit(); err != nil {
+		return file, err
+	}
+
+	if !fileExists {
+		d.watch(file)
 	}
 
-	cid, err := d.sh.Add(bytes.NewReader(b))
+	return file, nil
+}
+
+// upload reads the current contents of the file, adding and pinning
+// them in IPFS
+func (d *Datastore) upload(file *File) (err error) {
+	atomic.AddInt64(&d.uploading, 1)
+	defer atomic.AddInt64(&d.uploading, -1)
+
+	started := time.Now()
+	var b []byte
+	defer func() {
+		entry := log.WithFields(log.Fields{
+			"path":     file.AbsolutePath,
+			"cid":      file.CID,
+			"op":       "upload",
+			"size":     len(b),
+			"duration": time.Since(started).String(),
+		})
+		if err == nil {
+			entry.Debug("uploaded file")
+		}
+		d.emit(Event{
+			Type:         EventUpload,
+			AbsolutePath: file.AbsolutePath,
+			NewCID:       file.CID,
+			Size:         int64(len(b)),
+			Duration:     time.Since(started),
+			Err:          err,
+		})
+	}()
+
+	b, err = file.Read()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	file.AssignCID(CID(cid))
-	err = d.sh.Pin(cid)
+	cid, err := d.shell().Add(bytes.NewReader(b))
 	if err != nil {
-		return file, err
+		return err
 	}
 
+	if err := d.shell().Pin(cid); err != nil {
+		return err
+	}
+
+	old := file.CID
+	file.AssignCID(CID(cid))
+	d.emitFile(file.AbsolutePath, old, file.CID)
+	return nil
+}
+
+// track stores the file, watching it if it was not already tracked
+func (d *Datastore) track(file *File) {
 	d.mux.Lock()
+	_, exists := d.store[file.AbsolutePath]
 	d.store[file.AbsolutePath] = file
 	d.mux.Unlock()
 
-	if err := d.commit(); err != nil {
-		return file, err
+	if !exists {
+		d.watch(file)
 	}
+}
 
-	if !fileExists {
-		NewWatcher(file).Start(
-			d.fileRefreshInterval,
-			d.errs,
-			d.removals,
-			d.additions,
-		)
+// untrack removes the file from the store and stops its watcher
+func (d *Datastore) untrack(path FilePath) {
+	d.mux.Lock()
+	file, ok := d.store[path]
+	delete(d.store, path)
+	d.mux.Unlock()
+
+	if !ok {
+		return
+	}
+	if file.Watcher != nil {
+		file.Watcher.Stop()
 	}
+	d.emit(Event{
+		Type:         EventRemove,
+		AbsolutePath: path,
+		OldCID:       file.CID,
+	})
+}
 
-	return file, nil
+// watch starts a watcher for the file that reports back to the datastore
+func (d *Datastore) watch(file *File) {
+	NewWatcher(file).Start(
+		d.Settings().RefreshInterval,
+		d.errs,
+		d.removals,
+		d.additions,
+		d.emit,
+	)
 }
 
 // Add adds the file or directory at the given path to the store while communicating
@@ -204,7 +367,15 @@ func (d *Datastore) Add(path FilePath) (files chan *File, done chan struct{}, er
 
 		if info.IsDir() {
 			// recursively add all files within the directory
-			err := filepath.Walk(path.String(), func(path string, info fs.FileInfo, err error) error {
+			root := path.String()
+			err := filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+				if err != nil {
+					if path == root {
+						return err
+					}
+					log.WithFields(log.Fields{"path": path, "op": "add"}).WithError(err).Warn("skipping unreadable path")
+					return nil
+				}
 				if info.IsDir() {
 					return nil
 				}
@@ -242,17 +413,44 @@ func (d *Datastore) commit() error {
 		return err
 	}
 
-	cid, err := d.sh.Add(bytes.NewBuffer(b))
+	cid, err := d.shell().Add(bytes.NewBuffer(b))
 	if err != nil {
 		return err
 	}
 
 	var errs []error
-	if err := d.sh.Pin(cid); err != nil {
+	if err := d.shell().Pin(cid); err != nil {
 		errs = append(errs, err)
 	}
 
+	old, _ := d.CID()
 	d.UpdateCID(CID(cid))
+	d.mux.Lock()
+	d.committedAt = time.Now()
+	d.mux.Unlock()
+	if old != CID(cid) {
+		d.emit(Event{
+			Type:   EventCommit,
+			OldCID: old,
+			NewCID: CID(cid),
+			Size:   int64(len(b)),
+		})
+		d.mux.RLock()
+		files := len(d.store)
+		d.mux.RUnlock()
+		err := d.record(Snapshot{
+			CID:         CID(cid),
+			CommittedAt: time.Now(),
+			Files:       files,
+			Size:        int64(len(b)),
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if d.Settings().Names != nil {
+		d.publish(CID(cid))
+	}
 	err = d.backupCID()
 	if err != nil {
 		errs = append(errs, err)
@@ -274,7 +472,7 @@ func (d *Datastore) backupCID() error {
 	if !ok {
 		return fmt.Errorf("cid is not set")
 	}
-	return os.WriteFile(d.backupLocation, []byte(cid), 0644)
+	return os.WriteFile(d.Settings().BackupLocation, []byte(cid), 0644)
 }
 
 // CID returns the content indentifier for all store metadata
@@ -325,7 +523,12 @@ func (d *Datastore) JSON() ([]byte, error) {
 	return json.Marshal(d.store)
 }
 
-// FromJSON populates the datastore with files from a JSON payload
+// FromJSON populates the datastore with files from a JSON payload, the
+// last manifest committed by the datastore. Files whose size and
+// modification time match the payload are loaded as-is and only files
+// that changed on disk are verified and re-uploaded. Files already in
+// the store that disagree with the payload are resolved using the
+// configured conflict policy
 func (d *Datastore) FromJSON(b []byte) error {
 
 	tmp := make(store)
@@ -334,39 +537,331 @@ func (d *Datastore) FromJSON(b []byte) error {
 		return err
 	}
 
-Restore:
+	ctx := context.Background()
+	changed := false
 	for path, restoreFile := range tmp {
 
 		d.mux.RLock()
 		file, ok := d.store[path]
 		d.mux.RUnlock()
 
-		if ok && file.CID != restoreFile.CID {
-			return fmt.Errorf(
-				"conflict for file %s. current cid is %s, cid from IPFS is %s",
-				path,
-				file.CID,
-				restoreFile.CID,
-			)
-		}
-
-		files, done, errs := d.Add(path)
-		for {
-			select {
-			case <-files:
-			case <-done:
-				continue Restore
-			case err := <-errs:
+		if ok {
+			if file.CID != restoreFile.CID {
+				_, err := d.resolve(ctx, &Conflict{
+					AbsolutePath: path,
+					LocalCID:     file.CID,
+					RemoteCID:    restoreFile.CID,
+					DetectedAt:   time.Now(),
+				}, d.Settings().ConflictPolicy)
 				if err != nil {
 					return err
 				}
+				changed = true
 			}
+			continue
+		}
+
+		restoreFile.AbsolutePath = path
+		info, err := os.Stat(path.String())
+		if errors.Is(err, os.ErrNotExist) {
+			log.WithFields(log.Fields{"path": path, "op": "load"}).Info("file removed")
+			changed = true
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if !restoreFile.Modified(info) {
+			d.track(restoreFile)
+			continue
+		}
+
+		local, err := NewFile(path)
+		if err != nil {
+			return err
+		}
+		changed = true
+		if local.Sum == restoreFile.Sum {
+			local.AssignCID(restoreFile.CID)
+			d.track(local)
+			continue
+		}
+
+		// the payload is the last manifest committed here, so the file
+		// was edited while the daemon was stopped rather than conflicting
+		log.WithFields(log.Fields{"path": path, "op": "load"}).Info("file changed")
+		local.AssignCID(restoreFile.CID)
+		if err := d.upload(local); err != nil {
+			return err
 		}
+		d.track(local)
+	}
+
+	if changed {
+		return d.commit()
 	}
 
 	return nil
 }
 
+// Restore downloads the manifest at the given CID and brings every file
+// it lists into place. Files that disagree with their local copy are
+// resolved using the given policy. The progress function is called after
+// each file is processed and aborts the restore if it returns an error
+func (d *Datastore) Restore(
+	ctx context.Context,
+	cid CID,
+	policy ConflictPolicy,
+	progress func(completed, total int, file *File, conflict *Conflict) error,
+) error {
+
+	data, err := cat(ctx, d.shell(), cid.String())
+	if err != nil {
+		return err
+	}
+
+	tmp := make(store)
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+
+	completed := 0
+	for path, remote := range tmp {
+		remote.AbsolutePath = path
+		file, conflict, err := d.restoreFile(ctx, remote, policy)
+		if err != nil {
+			return err
+		}
+		completed++
+		if err := progress(completed, len(tmp), file, conflict); err != nil {
+			return err
+		}
+	}
+
+	return d.commit()
+}
+
+func (d *Datastore) restoreFile(ctx context.Context, remote *File, policy ConflictPolicy) (*File, *Conflict, error) {
+
+	path := remote.AbsolutePath
+
+	d.mux.RLock()
+	tracked, isTracked := d.store[path]
+	d.mux.RUnlock()
+
+	_, err := os.Stat(path.String())
+	if errors.Is(err, os.ErrNotExist) {
+		file, err := d.download(ctx, remote.CID, path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return file, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	local, err := NewFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	same := local.Sum == remote.Sum
+	if remote.Sum == "" {
+		// manifests written before checksums were recorded can only be
+		// compared by hashing the local contents
+		cid, err := d.shell().Add(bytes.NewReader(local.data.Bytes()), shell.OnlyHash(true))
+		if err != nil {
+			return nil, nil, err
+		}
+		same = CID(cid) == remote.CID
+	}
+
+	if same {
+		if isTracked {
+			return tracked, nil, nil
+		}
+		local.AssignCID(remote.CID)
+		if err := d.shell().Pin(remote.CID.String()); err != nil {
+			return nil, nil, err
+		}
+		d.track(local)
+		return local, nil, nil
+	}
+
+	conflict := &Conflict{
+		AbsolutePath: path,
+		RemoteCID:    remote.CID,
+		DetectedAt:   time.Now(),
+	}
+	if isTracked {
+		conflict.LocalCID = tracked.CID
+	}
+	file, err := d.resolve(ctx, conflict, policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, conflict, nil
+}
+
+// resolve settles the conflict using the given policy, returning the
+// file tracked at the conflicting path once resolved. Changes are not
+// committed
+func (d *Datastore) resolve(ctx context.Context, conflict *Conflict, policy ConflictPolicy) (*File, error) {
+
+	path := conflict.AbsolutePath
+	conflict.Resolution = policy
+
+	if policy == Ask {
+		log.WithFields(log.Fields{
+			"path":       path,
+			"local_cid":  conflict.LocalCID,
+			"remote_cid": conflict.RemoteCID,
+			"op":         "resolve",
+		}).Warn("conflict detected")
+		d.mux.Lock()
+		d.conflicts[path] = conflict
+		file := d.store[path]
+		d.mux.Unlock()
+		return file, nil
+	}
+
+	d.mux.Lock()
+	delete(d.conflicts, path)
+	d.mux.Unlock()
+
+	switch policy {
+	case PreferRemote:
+		return d.download(ctx, conflict.RemoteCID, path)
+	case KeepBoth:
+		if _, err := d.fetch(ctx, conflict.RemoteCID, conflict.CopyPath()); err != nil {
+			return nil, err
+		}
+	}
+
+	d.mux.RLock()
+	file, ok := d.store[path]
+	d.mux.RUnlock()
+	if !ok {
+		var err error
+		file, err = NewFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.upload(file); err != nil {
+		return nil, err
+	}
+	d.track(file)
+	return file, nil
+}
+
+// download writes the contents of the given CID to the path, tracking
+// the resulting file without uploading it again
+func (d *Datastore) download(ctx context.Context, cid CID, path FilePath) (*File, error) {
+
+	b, err := d.fetch(ctx, cid, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.shell().Pin(cid.String()); err != nil {
+		return nil, err
+	}
+
+	d.mux.RLock()
+	file, ok := d.store[path]
+	d.mux.RUnlock()
+	if !ok {
+		file = &File{AbsolutePath: path}
+	}
+
+	if _, err := file.Read(); err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(b)
+	if file.Sum != hex.EncodeToString(checksum[:]) {
+		return nil, fmt.Errorf("file %s changed while it was being restored", path)
+	}
+	old := file.CID
+	file.AssignCID(cid)
+	d.emitFile(path, old, cid)
+	d.track(file)
+	return file, nil
+}
+
+// fetch retrieves the contents of the given CID, atomically replacing
+// the file at path with them
+func (d *Datastore) fetch(ctx context.Context, cid CID, path FilePath) ([]byte, error) {
+
+	b, err := cat(ctx, d.shell(), cid.String())
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path.String())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(path.String()); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path.String())+".zync-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return nil, err
+	}
+
+	return b, os.Rename(tmp.Name(), path.String())
+}
+
+// Conflicts iterates over all unresolved conflicts until done() returns true
+func (d *Datastore) Conflicts(done func(*Conflict) (done bool)) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	for _, conflict := range d.conflicts {
+		if done(conflict) {
+			return
+		}
+	}
+}
+
+// ResolveConflict resolves the unresolved conflict for the given path
+// using the policy and commits the result
+func (d *Datastore) ResolveConflict(ctx context.Context, path FilePath, policy ConflictPolicy) (*Conflict, error) {
+
+	if policy == Ask {
+		return nil, fmt.Errorf("conflicts must be resolved with a policy other than %s", Ask)
+	}
+
+	d.mux.RLock()
+	conflict, ok := d.conflicts[path]
+	d.mux.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no conflict for file %s", path)
+	}
+
+	if _, err := d.resolve(ctx, conflict, policy); err != nil {
+		return nil, err
+	}
+
+	return conflict, d.commit()
+}
+
 // RangeStore iterates over all files in the store until done() returns true
 func (d *Datastore) RangeStore(done func(*File) (done bool)) {
 	d.mux.RLock()
@@ -377,3 +872,17 @@ func (d *Datastore) RangeStore(done func(*File) (done bool)) {
 		}
 	}
 }
+
+// Settings returns the settings the datastore is configured with
+func (d *Datastore) Settings() Settings {
+	d.settingsMux.RLock()
+	defer d.settingsMux.RUnlock()
+	return d.settings
+}
+
+// shell returns the client for the IPFS API
+func (d *Datastore) shell() *shell.Shell {
+	d.settingsMux.RLock()
+	defer d.settingsMux.RUnlock()
+	return d.sh
+}
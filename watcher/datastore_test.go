@@ -0,0 +1,83 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadUploadsLocalEdits(t *testing.T) {
+	for _, policy := range []ConflictPolicy{PreferLocal, PreferRemote, KeepBoth, Ask} {
+		t.Run(policy.String(), func(t *testing.T) {
+			fake, sh := newFakeIPFS(t)
+			settings := Settings{
+				BackupLocation: filepath.Join(t.TempDir(), "cid"),
+				ConflictPolicy: policy,
+			}
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "notes")
+			if err := ioutil.WriteFile(path, []byte("before"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// the watchers of the first daemon only poll hourly, so they
+			// never see the edit
+			first := newTestDatastore(t, sh, settings)
+			if _, err := first.AddFile(FilePath(path)); err != nil {
+				t.Fatalf("AddFile: %v", err)
+			}
+			committed, _ := first.CID()
+
+			// edited while the daemon was stopped
+			edited := []byte("edited while stopped")
+			if err := ioutil.WriteFile(path, edited, 0644); err != nil {
+				t.Fatal(err)
+			}
+			later := time.Now().Add(time.Minute)
+			if err := os.Chtimes(path, later, later); err != nil {
+				t.Fatal(err)
+			}
+
+			d := newTestDatastore(t, sh, settings)
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != string(edited) {
+				t.Fatalf("edit was replaced with %q", b)
+			}
+
+			entries, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("directory holds %d files, want only the edited file", len(entries))
+			}
+
+			conflicts := 0
+			d.Conflicts(func(*Conflict) bool {
+				conflicts++
+				return false
+			})
+			if conflicts != 0 {
+				t.Fatalf("loading recorded %d conflicts, want none", conflicts)
+			}
+
+			d.mux.RLock()
+			file, ok := d.store[FilePath(path)]
+			d.mux.RUnlock()
+			if !ok {
+				t.Fatal("edited file is no longer tracked")
+			}
+			if want := CID(fake.put(edited, false, false)); file.CID != want {
+				t.Fatalf("tracked cid = %s, want the edit %s", file.CID, want)
+			}
+			if cid, _ := d.CID(); cid == committed {
+				t.Fatal("the edit was not committed")
+			}
+		})
+	}
+}
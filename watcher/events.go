@@ -0,0 +1,144 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EventType describes what happened to a file or manifest
+type EventType string
+
+const (
+	// EventAdd is emitted when a file is first stored
+	EventAdd EventType = "add"
+	// EventUpdate is emitted when the CID of a stored file changes
+	EventUpdate EventType = "update"
+	// EventRemove is emitted when a file is no longer stored
+	EventRemove EventType = "remove"
+	// EventError is emitted when an error is encountered
+	EventError EventType = "error"
+	// EventCommit is emitted when a new manifest is committed
+	EventCommit EventType = "commit"
+	// EventUpload is emitted after every attempt to upload a file
+	EventUpload EventType = "upload"
+	// EventPoll is emitted every time a watcher checks its file for
+	// changes. Poll events are frequent and are not sent to clients
+	EventPoll EventType = "poll"
+)
+
+var eventTypes = map[EventType]zync.EventType{
+	EventAdd:    zync.EventType_EVENT_TYPE_ADD,
+	EventUpdate: zync.EventType_EVENT_TYPE_UPDATE,
+	EventRemove: zync.EventType_EVENT_TYPE_REMOVE,
+	EventError:  zync.EventType_EVENT_TYPE_ERROR,
+	EventCommit: zync.EventType_EVENT_TYPE_COMMIT,
+	EventUpload: zync.EventType_EVENT_TYPE_UPLOAD,
+}
+
+// Event describes activity within the datastore. Commit events carry
+// the previous and new manifest CIDs and no path. Upload and commit
+// events carry the number of bytes stored, and upload and poll events
+// carry how long they took
+type Event struct {
+	Type         EventType
+	AbsolutePath FilePath
+	OldCID       CID
+	NewCID       CID
+	Size         int64
+	Duration     time.Duration
+	Err          error
+	Time         time.Time
+}
+
+// Status returns the RPC format for the Event
+func (e Event) Status() *zync.Event {
+	event := &zync.Event{
+		Type:         eventTypes[e.Type],
+		AbsolutePath: e.AbsolutePath.String(),
+		OldCid:       e.OldCID.String(),
+		NewCid:       e.NewCID.String(),
+		Size:         e.Size,
+		Time:         timestamppb.New(e.Time),
+	}
+	if e.Duration != 0 {
+		event.Duration = durationpb.New(e.Duration)
+	}
+	if e.Err != nil {
+		event.Error = e.Err.Error()
+	}
+	return event
+}
+
+// eventBufferSize is the number of events buffered for each subscriber.
+// Events are dropped for subscribers that fall further behind
+const eventBufferSize = 256
+
+type events struct {
+	subscribers map[chan Event]struct{}
+	mux         sync.RWMutex
+}
+
+// Subscribe returns a channel receiving every event emitted by the
+// datastore until the context is done
+func (d *Datastore) Subscribe(ctx context.Context) <-chan Event {
+	sub := make(chan Event, eventBufferSize)
+
+	d.events.mux.Lock()
+	if d.events.subscribers == nil {
+		d.events.subscribers = make(map[chan Event]struct{})
+	}
+	d.events.subscribers[sub] = struct{}{}
+	d.events.mux.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		d.events.mux.Lock()
+		delete(d.events.subscribers, sub)
+		close(sub)
+		d.events.mux.Unlock()
+	}()
+
+	return sub
+}
+
+func (d *Datastore) emit(event Event) {
+	event.Time = time.Now()
+	d.events.mux.RLock()
+	defer d.events.mux.RUnlock()
+	for sub := range d.events.subscribers {
+		select {
+		case sub <- event:
+		default:
+		}
+	}
+}
+
+// emitFile emits an add or update event for the file if its CID changed
+func (d *Datastore) emitFile(path FilePath, oldCID, newCID CID) {
+	if oldCID == newCID {
+		return
+	}
+	eventType := EventUpdate
+	if oldCID == "" {
+		eventType = EventAdd
+	}
+	d.emit(Event{
+		Type:         eventType,
+		AbsolutePath: path,
+		OldCID:       oldCID,
+		NewCID:       newCID,
+	})
+}
+
+func (d *Datastore) emitError(path FilePath, err error) {
+	d.emit(Event{
+		Type:         EventError,
+		AbsolutePath: path,
+		Err:          err,
+	})
+}
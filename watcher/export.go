@@ -0,0 +1,241 @@
+package watcher
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gocid "github.com/ipfs/go-cid"
+)
+
+// ArchiveFormat is the kind of archive a snapshot is exported to
+type ArchiveFormat string
+
+const (
+	// Tar archives hold the contents of every file in a snapshot at its
+	// path, and can be extracted without IPFS
+	Tar ArchiveFormat = "tar"
+	// CAR archives hold every block referenced by a snapshot, and can be
+	// imported into any IPFS node
+	CAR ArchiveFormat = "car"
+)
+
+// paxCID is the PAX record holding the CID of each file in a tar archive,
+// which tar extracts as an extended attribute when asked to
+const paxCID = "SCHILY.xattr.user.zync.cid"
+
+// ParseArchiveFormat validates the given format name
+func ParseArchiveFormat(name string) (ArchiveFormat, error) {
+	switch format := ArchiveFormat(name); format {
+	case Tar, CAR:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown archive format %q. must be one of %s or %s", name, Tar, CAR)
+}
+
+func (f ArchiveFormat) String() string {
+	return string(f)
+}
+
+// Export writes the snapshot held at the given manifest CID to w as an
+// archive of the given format
+func (d *Datastore) Export(ctx context.Context, cid CID, format ArchiveFormat, w io.Writer) error {
+	files, err := d.fetchManifest(ctx, cid)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case Tar:
+		return d.exportTar(ctx, files, w)
+	case CAR:
+		return d.exportCAR(ctx, cid, files, w)
+	}
+	return fmt.Errorf("unknown archive format %q", format)
+}
+
+// exportTar writes every file in the manifest at its path, keeping its
+// size, modification time and CID
+func (d *Datastore) exportTar(ctx context.Context, files store, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, path := range files.paths() {
+		file := files[path]
+		b, err := cat(ctx, d.shell(), file.CID.String())
+		if err != nil {
+			return err
+		}
+		if file.Sum != "" {
+			checksum := sha256.Sum256(b)
+			if file.Sum != hex.EncodeToString(checksum[:]) {
+				return fmt.Errorf("contents of %s do not match its checksum", path)
+			}
+		}
+
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag:   tar.TypeReg,
+			Name:       strings.TrimPrefix(filepath.ToSlash(path.String()), "/"),
+			Size:       int64(len(b)),
+			Mode:       0644,
+			ModTime:    file.ModTime,
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{paxCID: file.CID.String()},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// exportCAR writes a CAR (https://ipld.io/specs/transport/car/carv1/)
+// whose roots are the manifest followed by every file it references,
+// holding all of the blocks reachable from them
+func (d *Datastore) exportCAR(ctx context.Context, manifest CID, files store, w io.Writer) error {
+	roots := []CID{manifest}
+	seen := map[CID]bool{manifest: true}
+	for _, path := range files.paths() {
+		if cid := files[path].CID; cid != "" && !seen[cid] {
+			seen[cid] = true
+			roots = append(roots, cid)
+		}
+	}
+
+	header, err := carHeader(roots)
+	if err != nil {
+		return err
+	}
+	if err := writeSection(w, header); err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, root := range roots {
+		if err := d.writeBlock(ctx, w, root.String(), written); err != nil {
+			return err
+		}
+		refs, err := d.shell().Refs(root.String(), true)
+		if err != nil {
+			return err
+		}
+		for ref := range refs {
+			if err := d.writeBlock(ctx, w, ref, written); err != nil {
+				// drain the refs so the request can finish
+				go func() {
+					for range refs {
+					}
+				}()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeBlock writes the block with the given CID to a CAR unless it has
+// already been written
+func (d *Datastore) writeBlock(ctx context.Context, w io.Writer, ref string, written map[string]bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cid, err := gocid.Decode(ref)
+	if err != nil {
+		return err
+	}
+	if written[cid.KeyString()] {
+		return nil
+	}
+
+	data, err := d.shell().BlockGet(cid.String())
+	if err != nil {
+		return err
+	}
+	sum, err := cid.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(cid) {
+		return fmt.Errorf("block %s does not match its cid", cid)
+	}
+
+	written[cid.KeyString()] = true
+	return writeSection(w, append(cid.Bytes(), data...))
+}
+
+// writeSection writes the data to a CAR prefixed by its length
+func writeSection(w io.Writer, data []byte) error {
+	length := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(length, uint64(len(data)))
+	if _, err := w.Write(length[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// carHeader encodes the DAG-CBOR map {"roots": [...], "version": 1}
+// that begins a CAR
+func carHeader(roots []CID) ([]byte, error) {
+	var b bytes.Buffer
+	b.Write(cborHead(5, 2))
+	b.Write(cborHead(3, uint64(len("roots"))))
+	b.WriteString("roots")
+	b.Write(cborHead(4, uint64(len(roots))))
+	for _, root := range roots {
+		cid, err := gocid.Decode(root.String())
+		if err != nil {
+			return nil, err
+		}
+		// CIDs are tag 42 holding the binary CID behind a zero byte
+		b.Write(cborHead(6, 42))
+		b.Write(cborHead(2, uint64(len(cid.Bytes())+1)))
+		b.WriteByte(0)
+		b.Write(cid.Bytes())
+	}
+	b.Write(cborHead(3, uint64(len("version"))))
+	b.WriteString("version")
+	b.Write(cborHead(0, 1))
+	return b.Bytes(), nil
+}
+
+// cborHead encodes the major type and argument that begin a CBOR item
+func cborHead(major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return []byte{major | byte(n)}
+	case n <= 0xff:
+		return []byte{major | 24, byte(n)}
+	case n <= 0xffff:
+		b := []byte{major | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	case n <= 0xffffffff:
+		b := []byte{major | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	}
+	b := []byte{major | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[1:], n)
+	return b
+}
+
+// paths returns the paths in the store in order
+func (s store) paths() []FilePath {
+	paths := make([]FilePath, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	return paths
+}
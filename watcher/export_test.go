@@ -0,0 +1,75 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	contents := map[string]string{
+		filepath.Join(dir, "notes"):         "notes",
+		filepath.Join(dir, "docs", "paper"): "paper",
+		filepath.Join(dir, "copy"):          "notes",
+	}
+
+	for _, format := range []ArchiveFormat{Tar, CAR} {
+		t.Run(format.String(), func(t *testing.T) {
+			fake, sh := newFakeIPFS(t)
+			d := newTestDatastore(t, sh, Settings{})
+			ctx := context.Background()
+			manifest := putManifest(t, fake, contents)
+
+			var archive bytes.Buffer
+			if err := d.Export(ctx, manifest, format, &archive); err != nil {
+				t.Fatalf("Export: %v", err)
+			}
+
+			// import into another node, which holds none of the blocks
+			other, otherSh := newFakeIPFS(t)
+			imported := newTestDatastore(t, otherSh, Settings{})
+			got, err := imported.Import(ctx, &archive, "", "/")
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if got.Files != len(contents) || got.Skipped != 0 {
+				t.Fatalf("imported %d files skipping %d, want %d", got.Files, got.Skipped, len(contents))
+			}
+			if format == CAR && got.CID != manifest {
+				t.Fatalf("imported manifest %s, want %s", got.CID, manifest)
+			}
+			if !other.pinned(got.CID) {
+				t.Fatal("imported manifest is not pinned")
+			}
+
+			want, err := d.fetchManifest(ctx, manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := imported.fetchManifest(ctx, got.CID)
+			if err != nil {
+				t.Fatalf("fetchManifest: %v", err)
+			}
+			for path, content := range contents {
+				file, ok := files[FilePath(path)]
+				if !ok {
+					t.Fatalf("%s was not imported", path)
+				}
+				if file.CID != want[FilePath(path)].CID || file.Sum != want[FilePath(path)].Sum {
+					t.Fatalf("%s was imported as %s, want %s", path, file.CID, want[FilePath(path)].CID)
+				}
+				if !file.ModTime.Equal(want[FilePath(path)].ModTime) {
+					t.Fatalf("%s was imported modified at %v, want %v", path, file.ModTime, want[FilePath(path)].ModTime)
+				}
+				if b, ok := other.block(file.CID.String()); !ok || string(b) != content {
+					t.Fatalf("%s was imported holding %q, want %q", path, b, content)
+				}
+				if !other.pinned(file.CID) {
+					t.Fatalf("%s is not pinned", path)
+				}
+			}
+		})
+	}
+}
@@ -3,10 +3,15 @@ package watcher
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
 	"io/ioutil"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/dnjp/zync/proto/zync/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // CID represents an IPFS content identifier. See https://docs.ipfs.io/concepts/content-addressing/
@@ -25,9 +30,12 @@ func (path FilePath) String() string {
 
 // File represents a file being watched
 type File struct {
-	CID          CID      `json:"cid"`
-	AbsolutePath FilePath `json:"absolute_path"`
-	Watcher      *Watcher `json:"-"`
+	CID          CID       `json:"cid"`
+	AbsolutePath FilePath  `json:"absolute_path"`
+	Sum          string    `json:"checksum,omitempty"`
+	Size         int64     `json:"size"`
+	ModTime      time.Time `json:"mod_time"`
+	Watcher      *Watcher  `json:"-"`
 	checksum     [32]byte
 	data         *bytes.Buffer
 	mux          sync.RWMutex
@@ -53,9 +61,15 @@ func (f *File) AssignCID(cid CID) {
 	f.mux.Unlock()
 }
 
-// Read reads the contents of the file, updating its current checksum
+// Read reads the contents of the file, updating its current checksum,
+// size and modification time
 func (f *File) Read() ([]byte, error) {
 
+	info, err := os.Stat(f.AbsolutePath.String())
+	if err != nil {
+		return nil, err
+	}
+
 	b, err := ioutil.ReadFile(f.AbsolutePath.String())
 	if err != nil {
 		return nil, err
@@ -63,6 +77,12 @@ func (f *File) Read() ([]byte, error) {
 
 	f.mux.Lock()
 	f.checksum = sha256.Sum256(b)
+	f.Sum = hex.EncodeToString(f.checksum[:])
+	f.Size = info.Size()
+	f.ModTime = info.ModTime()
+	if f.data == nil {
+		f.data = new(bytes.Buffer)
+	}
 	f.data.Reset()
 
 	_, err = f.data.Write(b)
@@ -75,21 +95,38 @@ func (f *File) Read() ([]byte, error) {
 	return b, nil
 }
 
-// Checksum prepares a SHA256 checksum of the file contents
+// Checksum prepares a SHA256 checksum of the file contents without
+// updating the recorded properties of the file
 func (f *File) Checksum() ([32]byte, error) {
-	b, err := f.Read()
+	b, err := ioutil.ReadFile(f.AbsolutePath.String())
 	if err != nil {
 		return [32]byte{}, err
 	}
 	return sha256.Sum256(b), nil
 }
 
+// Modified reports whether the size or modification time in info differ
+// from what was recorded the last time the file was read
+func (f *File) Modified(info fs.FileInfo) bool {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	return info.Size() != f.Size || !info.ModTime().Equal(f.ModTime)
+}
+
 // Status returns the RPC format for the File
 func (f *File) Status() *zync.File {
-	return &zync.File{
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	status := &zync.File{
 		Cid:          f.CID.String(),
 		AbsolutePath: f.AbsolutePath.String(),
+		Checksum:     f.Sum,
+		Size:         f.Size,
+	}
+	if !f.ModTime.IsZero() {
+		status.ModTime = timestamppb.New(f.ModTime)
 	}
+	return status
 }
 
 func (f *File) attachWatcher(w *Watcher) {
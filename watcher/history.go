@@ -0,0 +1,274 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxHistory bounds the number of snapshots remembered, dropping the
+// oldest first
+const maxHistory = 1000
+
+// ErrUnknownSnapshot is returned for a snapshot that is not in the
+// history
+var ErrUnknownSnapshot = errors.New("snapshot is not in the history")
+
+// Snapshot is a manifest committed by the datastore
+type Snapshot struct {
+	CID         CID       `json:"cid"`
+	CommittedAt time.Time `json:"committed_at"`
+	Files       int       `json:"files"`
+	Size        int64     `json:"size"`
+	// Label is set on the snapshots taken by Backup
+	Label string `json:"label,omitempty"`
+}
+
+// Version is a version of a file recorded in the snapshot history
+type Version struct {
+	CID     CID
+	Size    int64
+	ModTime time.Time
+	// Snapshot is the first snapshot holding this version
+	Snapshot Snapshot
+}
+
+func (d *Datastore) historyLocation() string {
+	return d.Settings().BackupLocation + ".history"
+}
+
+func (d *Datastore) loadHistory() error {
+	b, err := ioutil.ReadFile(d.historyLocation())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var history []Snapshot
+	if err := json.Unmarshal(b, &history); err != nil {
+		return err
+	}
+
+	d.mux.Lock()
+	d.history = history
+	d.mux.Unlock()
+	return nil
+}
+
+func (d *Datastore) saveHistory() error {
+	d.mux.RLock()
+	b, err := json.Marshal(d.history)
+	d.mux.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.historyLocation(), b, 0644)
+}
+
+// record adds a committed manifest to the snapshot history, releasing
+// the manifests that no longer fit in it
+func (d *Datastore) record(snapshot Snapshot) error {
+	d.mux.Lock()
+	d.history = append(d.history, snapshot)
+	var dropped []CID
+	if len(d.history) > maxHistory {
+		for _, snapshot := range d.history[:len(d.history)-maxHistory] {
+			dropped = append(dropped, snapshot.CID)
+		}
+		d.history = append([]Snapshot(nil), d.history[len(d.history)-maxHistory:]...)
+	}
+	d.mux.Unlock()
+	if err := d.saveHistory(); err != nil {
+		return err
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := d.release(ctx, dropped, log.Fields{"op": "commit"}); err != nil {
+		return fmt.Errorf("could not unpin snapshots dropped from the history: %w", err)
+	}
+	return nil
+}
+
+// History returns the snapshots committed by the datastore, newest
+// first
+func (d *Datastore) History() []Snapshot {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	history := make([]Snapshot, len(d.history))
+	for i, snapshot := range d.history {
+		history[len(history)-1-i] = snapshot
+	}
+	return history
+}
+
+// Manifest returns the files recorded in the manifest held at the given
+// CID. Manifests never change, so they are cached and must not be
+// modified
+func (d *Datastore) Manifest(ctx context.Context, cid CID) (map[FilePath]*File, error) {
+	d.mux.RLock()
+	files, ok := d.manifests[cid]
+	d.mux.RUnlock()
+	if ok {
+		return files, nil
+	}
+
+	files, err := d.fetchManifest(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mux.Lock()
+	d.manifests[cid] = files
+	d.mux.Unlock()
+	return files, nil
+}
+
+// Versions returns up to limit versions of the file at path recorded in
+// the snapshot history, newest first, or every version when limit is 0.
+// Only snapshots older than before are searched when it is set, so
+// passing the snapshot of the last version returned gives the next page,
+// and ErrUnknownSnapshot is returned when it is not in the history.
+// History is searched from the newest snapshot and only until limit
+// versions are found, as each snapshot is retrieved from the backend.
+// Snapshots that can no longer be retrieved are skipped
+func (d *Datastore) Versions(ctx context.Context, path FilePath, before CID, limit int) ([]Version, error) {
+	history := d.History()
+	if before != "" {
+		found := false
+		for i, snapshot := range history {
+			if snapshot.CID == before {
+				history, found = history[i+1:], true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSnapshot, before)
+		}
+	}
+
+	var versions []Version
+	for _, snapshot := range history {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		files, err := d.Manifest(ctx, snapshot.CID)
+		if err != nil {
+			log.WithFields(log.Fields{"cid": snapshot.CID, "op": "versions"}).WithError(err).
+				Debug("could not retrieve snapshot")
+			continue
+		}
+		file, ok := files[path]
+		if !ok {
+			continue
+		}
+		// an older snapshot holding the same version is where it first
+		// appeared
+		if n := len(versions); n > 0 && versions[n-1].CID == file.CID {
+			versions[n-1].Snapshot = snapshot
+			continue
+		}
+		if limit > 0 && len(versions) == limit {
+			break
+		}
+		versions = append(versions, Version{
+			CID:      file.CID,
+			Size:     file.Size,
+			ModTime:  file.ModTime,
+			Snapshot: snapshot,
+		})
+	}
+	return versions, nil
+}
+
+// Cat returns the contents held at the given CID by the backend
+func (d *Datastore) Cat(ctx context.Context, cid CID) (io.ReadCloser, error) {
+	resp, err := d.shell().Request("cat", cid.String()).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		resp.Close()
+		return nil, resp.Error
+	}
+	return resp.Output, nil
+}
+
+// Undo brings back the files held by the snapshot at the given CID that
+// are no longer in the datastore, resolving files that disagree with
+// their local copy using the datastore's conflict policy. Without a CID,
+// the newest snapshot holding files that have since been removed is
+// used, which undoes the last removal. The progress function is called
+// after each file is processed and aborts the undo if it returns an
+// error. It returns the snapshot the files were taken from
+func (d *Datastore) Undo(
+	ctx context.Context,
+	cid CID,
+	progress func(completed, total int, file *File, conflict *Conflict) error,
+) (CID, error) {
+
+	var removed []*File
+	if cid != "" {
+		files, err := d.Manifest(ctx, cid)
+		if err != nil {
+			return "", err
+		}
+		removed = d.untracked(files)
+	} else {
+		for _, snapshot := range d.History() {
+			files, err := d.Manifest(ctx, snapshot.CID)
+			if err != nil {
+				log.WithFields(log.Fields{"cid": snapshot.CID, "op": "undo"}).WithError(err).
+					Debug("could not retrieve snapshot")
+				continue
+			}
+			if removed = d.untracked(files); len(removed) > 0 {
+				cid = snapshot.CID
+				break
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return cid, fmt.Errorf("no removed files to bring back")
+	}
+
+	policy := d.Settings().ConflictPolicy
+	for i, remote := range removed {
+		file, conflict, err := d.restoreFile(ctx, remote, policy)
+		if err != nil {
+			return cid, err
+		}
+		if err := progress(i+1, len(removed), file, conflict); err != nil {
+			return cid, err
+		}
+	}
+
+	return cid, d.commit()
+}
+
+// untracked returns the files of a manifest that are not in the
+// datastore, sorted by path
+func (d *Datastore) untracked(files map[FilePath]*File) []*File {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	var removed []*File
+	for _, path := range store(files).paths() {
+		if _, ok := d.store[path]; ok {
+			continue
+		}
+		removed = append(removed, files[path])
+	}
+	return removed
+}
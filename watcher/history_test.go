@@ -0,0 +1,132 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionsPages(t *testing.T) {
+	fake, sh := newFakeIPFS(t)
+	d := newTestDatastore(t, sh, Settings{})
+
+	dir := t.TempDir()
+	notes, other := filepath.Join(dir, "notes"), filepath.Join(dir, "other")
+	write := func(path, contents string) {
+		t.Helper()
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.AddFile(FilePath(path)); err != nil {
+			t.Fatalf("AddFile: %v", err)
+		}
+	}
+	snapshot := func() CID {
+		t.Helper()
+		cid, ok := d.CID()
+		if !ok {
+			t.Fatal("nothing was committed")
+		}
+		return cid
+	}
+
+	write(notes, "first")
+	first := snapshot()
+	// snapshots that hold the same version do not repeat it
+	write(other, "other")
+	write(notes, "second")
+	second := snapshot()
+	if err := d.RemoveFile(FilePath(other)); err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	write(notes, "third")
+	third := snapshot()
+
+	want := []struct {
+		contents string
+		snapshot CID
+	}{
+		{"third", third},
+		{"second", second},
+		{"first", first},
+	}
+	check := func(versions []Version, from int) {
+		t.Helper()
+		for i, v := range versions {
+			w := want[from+i]
+			if cid := CID(fake.put([]byte(w.contents), false, false)); v.CID != cid {
+				t.Fatalf("version %d is %s, want %q", from+i, v.CID, w.contents)
+			}
+			if v.Snapshot.CID != w.snapshot {
+				t.Fatalf("version %d was first held by %s, want %s", from+i, v.Snapshot.CID, w.snapshot)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	all, err := d.Versions(ctx, FilePath(notes), "", 0)
+	if err != nil {
+		t.Fatalf("Versions: %v", err)
+	}
+	if len(all) != len(want) {
+		t.Fatalf("found %d versions, want %d", len(all), len(want))
+	}
+	check(all, 0)
+
+	page, err := d.Versions(ctx, FilePath(notes), "", 2)
+	if err != nil {
+		t.Fatalf("Versions: %v", err)
+	}
+	if len(page) != 2 {
+		t.Fatalf("first page holds %d versions, want 2", len(page))
+	}
+	check(page, 0)
+
+	page, err = d.Versions(ctx, FilePath(notes), page[1].Snapshot.CID, 2)
+	if err != nil {
+		t.Fatalf("Versions: %v", err)
+	}
+	if len(page) != 1 {
+		t.Fatalf("second page holds %d versions, want 1", len(page))
+	}
+	check(page, 2)
+
+	// a cursor that is not in the history would otherwise start over
+	if _, err := d.Versions(ctx, FilePath(notes), CID(fake.put([]byte("unknown"), false, false)), 2); !errors.Is(err, ErrUnknownSnapshot) {
+		t.Fatalf("Versions with an unknown cursor = %v, want ErrUnknownSnapshot", err)
+	}
+}
+
+func TestRecordUnpinsDroppedHistory(t *testing.T) {
+	fake, sh := newFakeIPFS(t)
+	d := newTestDatastore(t, sh, Settings{})
+
+	dir := t.TempDir()
+	old, shared := filepath.Join(dir, "old"), filepath.Join(dir, "shared")
+	oldest := putManifest(t, fake, map[string]string{old: "old", shared: "shared"})
+	kept := putManifest(t, fake, map[string]string{shared: "shared"})
+	d.mux.Lock()
+	d.history = []Snapshot{{CID: oldest}}
+	for len(d.history) < maxHistory {
+		d.history = append(d.history, Snapshot{CID: kept})
+	}
+	d.mux.Unlock()
+
+	if err := d.record(Snapshot{CID: kept}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if history := d.History(); len(history) != maxHistory || history[len(history)-1].CID != kept {
+		t.Fatalf("history holds %d snapshots, oldest %s, want %d without %s", len(history), history[len(history)-1].CID, maxHistory, oldest)
+	}
+	if fake.pinned(oldest) {
+		t.Fatal("manifest dropped from the history is still pinned")
+	}
+	if fake.pinned(CID(fake.put([]byte("old"), false, false))) {
+		t.Fatal("file only held by the dropped manifest is still pinned")
+	}
+	if !fake.pinned(kept) || !fake.pinned(CID(fake.put([]byte("shared"), false, false))) {
+		t.Fatal("manifest or file still in the history was unpinned")
+	}
+}
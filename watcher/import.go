@@ -0,0 +1,415 @@
+package watcher
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	gocid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSection bounds the size of a CAR section, which is far larger than
+// any block IPFS creates
+const maxSection = 32 << 20
+
+// Imported describes the snapshot created from an archive
+type Imported struct {
+	// CID is the manifest of the snapshot
+	CID CID
+	// Files counts the files in the snapshot
+	Files int
+	// Skipped counts the archive entries that are not regular files
+	Skipped int
+}
+
+// Import uploads the contents of a tar or CAR archive, returning the
+// snapshot they form. Archives may be gzipped. Tar archives are uploaded
+// file by file into a new manifest, with each entry placed relative to
+// root. CAR archives must have been written by Export, and their blocks
+// are uploaded as they are. The format is detected when it is empty
+func (d *Datastore) Import(ctx context.Context, r io.Reader, format ArchiveFormat, root FilePath) (*Imported, error) {
+	br, err := decompress(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		if format, err = detectArchive(br); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case Tar:
+		return d.importTar(ctx, br, root)
+	case CAR:
+		return d.importCAR(ctx, br)
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+// decompress returns a reader of the decompressed archive if it is
+// gzipped
+func decompress(br *bufio.Reader) (*bufio.Reader, error) {
+	magic, err := br.Peek(2)
+	if err != nil {
+		return nil, fmt.Errorf("could not read archive: %w", err)
+	}
+	if magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(gz), nil
+}
+
+// detectArchive peeks at the start of an archive to find its format
+func detectArchive(br *bufio.Reader) (ArchiveFormat, error) {
+	if b, err := br.Peek(262); err == nil && string(b[257:262]) == "ustar" {
+		return Tar, nil
+	}
+
+	// a CAR begins with the length of its header, which is a map of
+	// two entries
+	b, _ := br.Peek(binary.MaxVarintLen64 + 1)
+	if length, n := binary.Uvarint(b); n > 0 && length > 0 && n < len(b) && b[n] == 0xa2 {
+		return CAR, nil
+	}
+	return "", fmt.Errorf("could not detect archive format. must be %s or %s", Tar, CAR)
+}
+
+// importTar uploads every regular file in the archive and commits a
+// manifest holding them
+func (d *Datastore) importTar(ctx context.Context, r io.Reader, root FilePath) (*Imported, error) {
+	if !filepath.IsAbs(root.String()) {
+		return nil, fmt.Errorf("root %s must be an absolute path", root)
+	}
+
+	imported := &Imported{}
+	files := make(store)
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			imported.Skipped++
+			continue
+		}
+
+		path := FilePath(filepath.Join(root.String(), filepath.FromSlash(header.Name)))
+		if rel, err := filepath.Rel(root.String(), path.String()); err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("archive entry %s is outside of %s", header.Name, root)
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		cid, err := d.shell().Add(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		if err := d.shell().Pin(cid); err != nil {
+			return nil, err
+		}
+		log.WithFields(log.Fields{"path": path, "cid": cid, "op": "import"}).Debug("imported file")
+
+		checksum := sha256.Sum256(b)
+		files[path] = &File{
+			CID:          CID(cid),
+			AbsolutePath: path,
+			Sum:          hex.EncodeToString(checksum[:]),
+			Size:         int64(len(b)),
+			ModTime:      header.ModTime,
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("archive holds no files")
+	}
+
+	b, err := json.Marshal(files)
+	if err != nil {
+		return nil, err
+	}
+	cid, err := d.shell().Add(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if err := d.shell().Pin(cid); err != nil {
+		return nil, err
+	}
+
+	imported.CID = CID(cid)
+	imported.Files = len(files)
+	return imported, nil
+}
+
+// importCAR uploads every block in the archive, then pins the manifest
+// held by its first root and every file the manifest references
+func (d *Datastore) importCAR(ctx context.Context, br *bufio.Reader) (*Imported, error) {
+	header, err := readSection(br)
+	if err != nil {
+		return nil, fmt.Errorf("could not read car header: %w", err)
+	}
+	roots, err := carRoots(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("car has no roots")
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		section, err := readSection(br)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := d.putBlock(section); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := CID(roots[0].String())
+	files, err := d.fetchManifest(ctx, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("first root of the car is not a manifest: %w", err)
+	}
+	for _, path := range files.paths() {
+		if err := d.shell().Pin(files[path].CID.String()); err != nil {
+			return nil, fmt.Errorf("could not pin %s: %w", path, err)
+		}
+	}
+	if err := d.shell().Pin(manifest.String()); err != nil {
+		return nil, err
+	}
+
+	return &Imported{CID: manifest, Files: len(files)}, nil
+}
+
+// putBlock uploads the block held by a CAR section, checking that the
+// backend stores it under the same CID
+func (d *Datastore) putBlock(section []byte) error {
+	n, cid, err := gocid.CidFromBytes(section)
+	if err != nil {
+		return err
+	}
+	data := section[n:]
+
+	prefix := cid.Prefix()
+	sum, err := prefix.Sum(data)
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(cid) {
+		return fmt.Errorf("block %s does not match its cid", cid)
+	}
+
+	format := gocid.CodecToStr[prefix.Codec]
+	if prefix.Version == 0 {
+		format = "v0"
+	}
+	key, err := d.shell().BlockPut(data, format, mh.Codes[prefix.MhType], prefix.MhLength)
+	if err != nil {
+		return err
+	}
+	stored, err := gocid.Decode(key)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stored.Hash(), cid.Hash()) {
+		return fmt.Errorf("block %s was stored as %s", cid, stored)
+	}
+	return nil
+}
+
+// readSection reads the next length prefixed section of a CAR
+func readSection(br *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 || length > maxSection {
+		return nil, fmt.Errorf("invalid car section length %d", length)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// carRoots decodes the roots of a CAR header
+func carRoots(header []byte) ([]gocid.Cid, error) {
+	r := &cborReader{b: header}
+	v, err := r.decode()
+	if err != nil {
+		return nil, fmt.Errorf("could not decode car header: %w", err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("car header is not a map")
+	}
+	if version, ok := m["version"].(uint64); !ok || version != 1 {
+		return nil, fmt.Errorf("unsupported car version %v", m["version"])
+	}
+	list, ok := m["roots"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("car header has no roots")
+	}
+
+	roots := make([]gocid.Cid, 0, len(list))
+	for _, root := range list {
+		cid, ok := root.(gocid.Cid)
+		if !ok {
+			return nil, fmt.Errorf("car root %v is not a cid", root)
+		}
+		roots = append(roots, cid)
+	}
+	return roots, nil
+}
+
+// cborReader decodes the subset of DAG-CBOR used by CAR headers
+type cborReader struct {
+	b []byte
+}
+
+func (r *cborReader) head() (major byte, n uint64, err error) {
+	if len(r.b) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	major, info := r.b[0]>>5, r.b[0]&0x1f
+	r.b = r.b[1:]
+
+	size := 0
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("unsupported cbor item %#x", info)
+	}
+	if len(r.b) < size {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	for _, c := range r.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	r.b = r.b[size:]
+	return major, n, nil
+}
+
+func (r *cborReader) bytes(n uint64) ([]byte, error) {
+	if uint64(len(r.b)) < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b, nil
+}
+
+// fits checks that n items could follow, as each takes at least a byte,
+// so lengths read from an archive never size an allocation on their own
+func (r *cborReader) fits(n uint64) error {
+	if n > uint64(len(r.b)) {
+		return fmt.Errorf("cbor length %d exceeds the %d bytes remaining: %w", n, len(r.b), io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+func (r *cborReader) decode() (interface{}, error) {
+	major, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		return n, nil
+	case 2:
+		return r.bytes(n)
+	case 3:
+		b, err := r.bytes(n)
+		return string(b), err
+	case 4:
+		if err := r.fits(n); err != nil {
+			return nil, err
+		}
+		list := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := r.decode()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case 5:
+		if err := r.fits(n); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := r.decode()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("cbor map key %v is not a string", k)
+			}
+			if m[key], err = r.decode(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case 6:
+		if n != 42 {
+			return nil, fmt.Errorf("unsupported cbor tag %d", n)
+		}
+		v, err := r.decode()
+		if err != nil {
+			return nil, err
+		}
+		// CIDs are held behind a zero byte
+		b, ok := v.([]byte)
+		if !ok || len(b) < 2 || b[0] != 0 {
+			return nil, fmt.Errorf("invalid cid in cbor")
+		}
+		return gocid.Cast(b[1:])
+	}
+	return nil, fmt.Errorf("unsupported cbor major type %d", major)
+}
@@ -0,0 +1,79 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+const testRoot = "QmT8Mb1Ke4GVZoEZtzYQ4VhHzTS4ehTHwMfsDfGvhVwpAp"
+
+func uvarint(n uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return b[:binary.PutUvarint(b, n)]
+}
+
+func TestCarRoots(t *testing.T) {
+	header, err := carHeader([]CID{testRoot})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := carRoots(header)
+	if err != nil {
+		t.Fatalf("carRoots: %v", err)
+	}
+	if len(roots) != 1 || roots[0].String() != testRoot {
+		t.Fatalf("carRoots = %v, want [%s]", roots, testRoot)
+	}
+}
+
+func TestCarRootsMalformed(t *testing.T) {
+	valid, err := carHeader([]CID{testRoot})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{name: "empty", header: nil},
+		{name: "truncated", header: valid[:len(valid)/2]},
+		{name: "missing length", header: []byte{0x9b, 0xff}},
+		{name: "oversized array", header: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "oversized map", header: []byte{0xbb, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "array longer than header", header: []byte{0x98, 0x20, 0x01, 0x01}},
+		{name: "oversized bytes", header: []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "not a map", header: []byte{0x80}},
+		{name: "no roots", header: []byte{0xa1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01}},
+		{name: "wrong version", header: append(append([]byte{}, valid[:len(valid)-1]...), 0x02)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if roots, err := carRoots(tt.header); err == nil {
+				t.Fatalf("carRoots = %v, want an error", roots)
+			}
+		})
+	}
+}
+
+func TestReadSectionMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		car  []byte
+	}{
+		{name: "empty", car: nil},
+		{name: "zero length", car: []byte{0}},
+		{name: "oversized", car: uvarint(maxSection + 1)},
+		{name: "truncated", car: append(uvarint(16), 1, 2, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if section, err := readSection(bufio.NewReader(bytes.NewReader(tt.car))); err == nil {
+				t.Fatalf("readSection = %v, want an error", section)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package watcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gocid "github.com/ipfs/go-cid"
+	shell "github.com/ipfs/go-ipfs-api"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// fakeIPFS serves the parts of the IPFS HTTP API used by the datastore,
+// keeping everything in memory
+type fakeIPFS struct {
+	blocks map[string][]byte
+	pins   map[string]bool
+	files  map[string][]byte
+	// failAdds fails every add while set
+	failAdds bool
+	mux      sync.Mutex
+}
+
+// newFakeIPFS starts a fake IPFS node for the duration of the test,
+// returning a shell connected to it
+func newFakeIPFS(t *testing.T) (*fakeIPFS, *shell.Shell) {
+	t.Helper()
+	f := &fakeIPFS{
+		blocks: make(map[string][]byte),
+		pins:   make(map[string]bool),
+		files:  make(map[string][]byte),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/add", func(w http.ResponseWriter, r *http.Request) {
+		f.mux.Lock()
+		failAdds := f.failAdds
+		f.mux.Unlock()
+		if failAdds {
+			ipfsError(w, "add failed")
+			return
+		}
+		b, ok := f.upload(w, r)
+		if !ok {
+			return
+		}
+		cid := f.put(b, r.URL.Query().Get("only-hash") != "true", r.URL.Query().Get("pin") != "false")
+		json.NewEncoder(w).Encode(map[string]string{"Hash": cid, "Name": cid})
+	})
+	mux.HandleFunc("/api/v0/cat", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := f.block(strings.TrimPrefix(r.URL.Query().Get("arg"), "/ipfs/"))
+		if !ok {
+			ipfsError(w, "block not found")
+			return
+		}
+		w.Write(b)
+	})
+	mux.HandleFunc("/api/v0/pin/add", func(w http.ResponseWriter, r *http.Request) {
+		cid := r.URL.Query().Get("arg")
+		if _, ok := f.block(cid); !ok {
+			ipfsError(w, "block not found")
+			return
+		}
+		f.mux.Lock()
+		f.pins[cid] = true
+		f.mux.Unlock()
+		json.NewEncoder(w).Encode(map[string][]string{"Pins": {cid}})
+	})
+	mux.HandleFunc("/api/v0/pin/ls", func(w http.ResponseWriter, r *http.Request) {
+		cid := r.URL.Query().Get("arg")
+		f.mux.Lock()
+		defer f.mux.Unlock()
+		if !f.pins[cid] {
+			ipfsError(w, "path '"+cid+"' is not pinned")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"Keys": map[string]interface{}{cid: map[string]string{"Type": "recursive"}}})
+	})
+	mux.HandleFunc("/api/v0/pin/rm", func(w http.ResponseWriter, r *http.Request) {
+		cid := r.URL.Query().Get("arg")
+		f.mux.Lock()
+		defer f.mux.Unlock()
+		if !f.pins[cid] {
+			ipfsError(w, "not pinned or pinned indirectly")
+			return
+		}
+		delete(f.pins, cid)
+		json.NewEncoder(w).Encode(map[string][]string{"Pins": {cid}})
+	})
+	mux.HandleFunc("/api/v0/block/get", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := f.block(r.URL.Query().Get("arg"))
+		if !ok {
+			ipfsError(w, "block not found")
+			return
+		}
+		w.Write(b)
+	})
+	mux.HandleFunc("/api/v0/block/put", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := f.upload(w, r)
+		if !ok {
+			return
+		}
+		cid := f.put(b, true, false)
+		json.NewEncoder(w).Encode(map[string]interface{}{"Key": cid, "Size": len(b)})
+	})
+	// blocks are stored whole, so they link to nothing
+	mux.HandleFunc("/api/v0/refs", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.block(r.URL.Query().Get("arg")); !ok {
+			ipfsError(w, "block not found")
+		}
+	})
+	mux.HandleFunc("/api/v0/files/read", func(w http.ResponseWriter, r *http.Request) {
+		f.mux.Lock()
+		b, ok := f.files[r.URL.Query().Get("arg")]
+		f.mux.Unlock()
+		if !ok {
+			ipfsError(w, "file does not exist")
+			return
+		}
+		w.Write(b)
+	})
+	mux.HandleFunc("/api/v0/files/write", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := f.upload(w, r)
+		if !ok {
+			return
+		}
+		f.mux.Lock()
+		f.files[r.URL.Query().Get("arg")] = b
+		f.mux.Unlock()
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return f, shell.NewShell(server.URL)
+}
+
+// put stores the data, returning its CID
+func (f *fakeIPFS) put(b []byte, store, pin bool) string {
+	hash, _ := mh.Sum(b, mh.SHA2_256, -1)
+	cid := gocid.NewCidV0(hash).String()
+	if store {
+		f.mux.Lock()
+		f.blocks[cid] = b
+		if pin {
+			f.pins[cid] = true
+		}
+		f.mux.Unlock()
+	}
+	return cid
+}
+
+func (f *fakeIPFS) block(cid string) ([]byte, bool) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	b, ok := f.blocks[cid]
+	return b, ok
+}
+
+func (f *fakeIPFS) pinned(cid CID) bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.pins[cid.String()]
+}
+
+// upload reads the first file of a multipart request
+func (f *fakeIPFS) upload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		ipfsError(w, err.Error())
+		return nil, false
+	}
+	part, err := mr.NextPart()
+	if err != nil {
+		ipfsError(w, err.Error())
+		return nil, false
+	}
+	b, err := ioutil.ReadAll(part)
+	if err != nil {
+		ipfsError(w, err.Error())
+		return nil, false
+	}
+	return b, true
+}
+
+func ipfsError(w http.ResponseWriter, message string) {
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]interface{}{"Message": message, "Code": 0, "Type": "error"})
+}
+
+// newTestDatastore constructs a datastore backed by a fake IPFS node,
+// keeping its state in a temporary directory. The datastore is stopped
+// when the test ends
+func newTestDatastore(t *testing.T, sh *shell.Shell, settings Settings) *Datastore {
+	t.Helper()
+	if settings.BackupLocation == "" {
+		settings.BackupLocation = filepath.Join(t.TempDir(), "cid")
+	}
+	if settings.RefreshInterval == 0 {
+		settings.RefreshInterval = time.Hour
+	}
+	if settings.FollowInterval == 0 {
+		settings.FollowInterval = 5 * time.Second
+	}
+	if settings.ConflictPolicy == "" {
+		settings.ConflictPolicy = PreferLocal
+	}
+
+	d, err := NewDatastore(sh, settings)
+	if err != nil {
+		t.Fatalf("NewDatastore: %v", err)
+	}
+	t.Cleanup(func() { d.Stop() })
+	return d
+}
+
+// eventually fails the test unless cond holds within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
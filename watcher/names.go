@@ -0,0 +1,155 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gocid "github.com/ipfs/go-cid"
+	shell "github.com/ipfs/go-ipfs-api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Names publishes and resolves mutable names that point at manifests,
+// allowing other devices to find the latest backup
+type Names interface {
+	// Publish points the name at the given CID, returning the name
+	Publish(ctx context.Context, cid CID) (name string, err error)
+	// Resolve returns the CID the given name currently points at
+	Resolve(ctx context.Context, name string) (CID, error)
+	// Name returns the name manifests are published under
+	Name(ctx context.Context) (string, error)
+}
+
+// IPNS publishes names using the InterPlanetary Name System. See
+// https://docs.ipfs.io/concepts/ipns/
+type IPNS struct {
+	sh  *shell.Shell
+	key string
+}
+
+// NewIPNS constructs an IPNS publisher that publishes under the given
+// key. The key must exist on the IPFS node, see `ipfs key gen`
+func NewIPNS(sh *shell.Shell, key string) *IPNS {
+	return &IPNS{
+		sh:  sh,
+		key: key,
+	}
+}
+
+// Publish points the name of the configured key at the given CID
+func (n *IPNS) Publish(ctx context.Context, cid CID) (string, error) {
+	var resp struct {
+		Name  string
+		Value string
+	}
+	err := n.sh.Request("name/publish", "/ipfs/"+cid.String()).
+		Option("key", n.key).
+		Exec(ctx, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Name, nil
+}
+
+// Name returns the IPNS name of the configured key
+func (n *IPNS) Name(ctx context.Context) (string, error) {
+	keys, err := n.sh.KeyList(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		if key.Name == n.key {
+			return key.Id, nil
+		}
+	}
+	return "", fmt.Errorf("key %s does not exist", n.key)
+}
+
+// Resolve returns the CID the given IPNS name currently points at
+func (n *IPNS) Resolve(ctx context.Context, name string) (CID, error) {
+	var resp struct{ Path string }
+	err := n.sh.Request("name/resolve", name).Exec(ctx, &resp)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resp.Path, "/ipfs/") {
+		return "", fmt.Errorf("name %s resolved to %s, which is not an IPFS path", name, resp.Path)
+	}
+	return CID(strings.TrimPrefix(resp.Path, "/ipfs/")), nil
+}
+
+// names returns the configured name system, falling back to resolving
+// names with IPNS when none is configured
+func (d *Datastore) names() Names {
+	if names := d.Settings().Names; names != nil {
+		return names
+	}
+	return NewIPNS(d.shell(), "")
+}
+
+// ResolveManifest returns the CID of the manifest that ref refers to. ref
+// may be a CID, an /ipfs/ path, a tag, or a name such as an /ipns/ path
+// or a bare IPNS key
+func (d *Datastore) ResolveManifest(ctx context.Context, ref string) (CID, error) {
+	if strings.HasPrefix(ref, "/ipfs/") {
+		return CID(strings.TrimPrefix(ref, "/ipfs/")), nil
+	}
+	if !strings.HasPrefix(ref, "/ipns/") {
+		cid, err := gocid.Decode(ref)
+		if err == nil && cid.Type() != gocid.Libp2pKey {
+			return CID(ref), nil
+		}
+		if ValidateTagName(ref) == nil {
+			tags, err := d.loadTags(ctx)
+			if err != nil {
+				return "", err
+			}
+			if tag, ok := tags[ref]; ok {
+				return tag.CID, nil
+			}
+		}
+	}
+	return d.names().Resolve(ctx, ref)
+}
+
+func (d *Datastore) listenPublishes(published chan CID) {
+	for {
+		select {
+		case <-d.stop:
+			return
+		case cid := <-published:
+			names := d.Settings().Names
+			if names == nil {
+				continue
+			}
+			name, err := names.Publish(context.Background(), cid)
+			if err != nil {
+				log.WithFields(log.Fields{"cid": cid, "op": "publish"}).WithError(err).Error("could not publish manifest")
+				d.emitError("", err)
+				continue
+			}
+			log.WithFields(log.Fields{"cid": cid, "name": name, "op": "publish"}).Info("published manifest")
+			if err := d.announce(context.Background(), cid); err != nil {
+				log.WithFields(log.Fields{"cid": cid, "op": "announce"}).WithError(err).Error("could not announce manifest")
+				d.emitError("", err)
+			}
+		}
+	}
+}
+
+// publish queues the CID to be published, replacing any CID that has
+// not been published yet since only the latest manifest matters
+func (d *Datastore) publish(cid CID) {
+	for {
+		select {
+		case d.published <- cid:
+			return
+		default:
+		}
+		select {
+		case <-d.published:
+		default:
+		}
+	}
+}
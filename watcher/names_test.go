@@ -0,0 +1,127 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testName is a valid IPNS name, as names are CIDs of libp2p keys
+const testName = "k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8"
+
+// fakeNames is a Names publishing to a registry shared by every device
+// of a test
+type fakeNames struct {
+	name     string
+	registry *nameRegistry
+}
+
+type nameRegistry struct {
+	records map[string]CID
+	mux     sync.Mutex
+}
+
+func newNameRegistry() *nameRegistry {
+	return &nameRegistry{records: make(map[string]CID)}
+}
+
+// device returns the Names of a device publishing under name
+func (r *nameRegistry) device(name string) *fakeNames {
+	return &fakeNames{name: name, registry: r}
+}
+
+func (r *nameRegistry) set(name string, cid CID) {
+	r.mux.Lock()
+	r.records[name] = cid
+	r.mux.Unlock()
+}
+
+func (r *nameRegistry) get(name string) (CID, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	cid, ok := r.records[strings.TrimPrefix(name, "/ipns/")]
+	return cid, ok
+}
+
+func (n *fakeNames) Publish(ctx context.Context, cid CID) (string, error) {
+	n.registry.set(n.name, cid)
+	return n.name, nil
+}
+
+func (n *fakeNames) Resolve(ctx context.Context, name string) (CID, error) {
+	cid, ok := n.registry.get(name)
+	if !ok {
+		return "", fmt.Errorf("could not resolve %s", name)
+	}
+	return cid, nil
+}
+
+func (n *fakeNames) Name(ctx context.Context) (string, error) {
+	return n.name, nil
+}
+
+func TestPublishOnCommit(t *testing.T) {
+	_, sh := newFakeIPFS(t)
+	registry := newNameRegistry()
+	d := newTestDatastore(t, sh, Settings{Names: registry.device(testName)})
+	go d.listenPublishes(d.published)
+
+	path := filepath.Join(t.TempDir(), "hello")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.AddFile(FilePath(path)); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+
+	cid, ok := d.CID()
+	if !ok {
+		t.Fatal("nothing was committed")
+	}
+	eventually(t, "the commit to be published", func() bool {
+		published, _ := registry.get(testName)
+		return published == cid
+	})
+}
+
+func TestResolveManifest(t *testing.T) {
+	_, sh := newFakeIPFS(t)
+	registry := newNameRegistry()
+	d := newTestDatastore(t, sh, Settings{Names: registry.device(testName)})
+
+	const manifest = CID("QmT8Mb1Ke4GVZoEZtzYQ4VhHzTS4ehTHwMfsDfGvhVwpAp")
+	registry.set(testName, manifest)
+
+	tests := []struct {
+		ref     string
+		want    CID
+		wantErr bool
+	}{
+		{ref: "/ipns/" + testName, want: manifest},
+		{ref: testName, want: manifest},
+		{ref: "/ipfs/QmSvPd3sHK7iWgZuW47fyLy4CaZQe2DwxvRhrJ39VpBVMK", want: "QmSvPd3sHK7iWgZuW47fyLy4CaZQe2DwxvRhrJ39VpBVMK"},
+		{ref: "QmSvPd3sHK7iWgZuW47fyLy4CaZQe2DwxvRhrJ39VpBVMK", want: "QmSvPd3sHK7iWgZuW47fyLy4CaZQe2DwxvRhrJ39VpBVMK"},
+		{ref: "/ipns/k51qzi5uqu5dlnwjrnyyd6sl2i729d8qjv1bchfqpmgfeu8jn1w1p4q9x9uqit", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			cid, err := d.ResolveManifest(context.Background(), tt.ref)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ResolveManifest = %s, want an error", cid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveManifest: %v", err)
+			}
+			if cid != tt.want {
+				t.Fatalf("ResolveManifest = %s, want %s", cid, tt.want)
+			}
+		})
+	}
+}
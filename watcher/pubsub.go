@@ -0,0 +1,218 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	log "github.com/sirupsen/logrus"
+)
+
+// Broker delivers messages to every subscriber of a topic
+type Broker interface {
+	// Publish sends the data to all subscribers of the topic
+	Publish(ctx context.Context, topic string, data []byte) error
+	// Subscribe returns a channel receiving every message published to
+	// the topic. The channel is closed once the context is done or the
+	// subscription fails
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+}
+
+// PubSub is a Broker backed by IPFS pubsub. The IPFS node must be
+// started with --enable-pubsub-experiment
+type PubSub struct {
+	sh *shell.Shell
+}
+
+// NewPubSub constructs a Broker that uses the pubsub system of the IPFS node
+func NewPubSub(sh *shell.Shell) *PubSub {
+	return &PubSub{sh: sh}
+}
+
+// Publish sends the data to all subscribers of the topic
+func (p *PubSub) Publish(ctx context.Context, topic string, data []byte) error {
+	return p.sh.PubSubPublish(topic, string(data))
+}
+
+// Subscribe returns a channel receiving every message published to the topic
+func (p *PubSub) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	sub, err := p.sh.PubSubSubscribe(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make(chan []byte)
+	go func() {
+		<-ctx.Done()
+		sub.Cancel()
+	}()
+	go func() {
+		defer close(messages)
+		for {
+			msg, err := sub.Next()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.WithFields(log.Fields{"topic": topic, "op": "subscribe"}).WithError(err).Error("subscription failed")
+				}
+				return
+			}
+			select {
+			case messages <- msg.Data:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// LocalBroker is an in-process Broker, delivering messages between
+// subscribers within the same process
+type LocalBroker struct {
+	subscribers map[string]map[chan []byte]struct{}
+	mux         sync.Mutex
+}
+
+// NewLocalBroker constructs an in-process Broker
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{
+		subscribers: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+// Publish sends the data to all subscribers of the topic
+func (b *LocalBroker) Publish(ctx context.Context, topic string, data []byte) error {
+	b.mux.Lock()
+	subscribers := make([]chan []byte, 0, len(b.subscribers[topic]))
+	for sub := range b.subscribers[topic] {
+		subscribers = append(subscribers, sub)
+	}
+	b.mux.Unlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub <- data:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving every message published to the topic
+func (b *LocalBroker) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	sub := make(chan []byte, 16)
+
+	b.mux.Lock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan []byte]struct{})
+	}
+	b.subscribers[topic][sub] = struct{}{}
+	b.mux.Unlock()
+
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+		defer func() {
+			b.mux.Lock()
+			delete(b.subscribers[topic], sub)
+			b.mux.Unlock()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case data := <-sub:
+				select {
+				case messages <- data:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// announcement is published whenever a new manifest is committed
+type announcement struct {
+	Name string `json:"name"`
+	CID  CID    `json:"cid"`
+}
+
+// announce tells subscribers of the configured topic that the manifest
+// published under our name now points at the given CID. Subscribers
+// resolve the name before applying it, so the name must be published
+// first
+func (d *Datastore) announce(ctx context.Context, cid CID) error {
+	settings := d.Settings()
+	if settings.Broker == nil || settings.Topic == "" || settings.Names == nil {
+		return nil
+	}
+
+	name, err := settings.Names.Name(ctx)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(announcement{Name: name, CID: cid})
+	if err != nil {
+		return err
+	}
+	return settings.Broker.Publish(ctx, settings.Topic, b)
+}
+
+func (d *Datastore) listenAnnouncements(settings Settings, stop chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-d.stop:
+		case <-stop:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	messages, err := settings.Broker.Subscribe(ctx, settings.Topic)
+	if err != nil {
+		log.WithFields(log.Fields{"topic": settings.Topic, "op": "subscribe"}).WithError(err).Error("could not subscribe")
+		return
+	}
+
+	followed := make(map[string]string)
+	for _, name := range settings.Follow {
+		followed[strings.TrimPrefix(name, "/ipns/")] = name
+	}
+
+	for data := range messages {
+		var a announcement
+		if err := json.Unmarshal(data, &a); err != nil {
+			log.WithFields(log.Fields{"topic": settings.Topic, "op": "subscribe"}).WithError(err).Warn("ignoring malformed announcement")
+			continue
+		}
+		name, ok := followed[strings.TrimPrefix(a.Name, "/ipns/")]
+		if !ok {
+			continue
+		}
+		syncCtx, cancel := context.WithTimeout(ctx, settings.FollowInterval)
+		// anyone can publish to the topic, so the announcement is only
+		// trusted once the name itself points at the manifest
+		resolved, err := d.names().Resolve(syncCtx, name)
+		if err != nil || resolved != a.CID {
+			log.WithFields(log.Fields{"cid": a.CID, "name": a.Name, "resolved": resolved, "op": "sync"}).WithError(err).
+				Warn("ignoring announcement the name does not point at")
+			cancel()
+			continue
+		}
+		if err := d.apply(syncCtx, name, a.CID); err != nil {
+			log.WithFields(log.Fields{"cid": a.CID, "name": a.Name, "op": "sync"}).WithError(err).Error("could not sync")
+			d.emitError("", err)
+		}
+		cancel()
+	}
+}
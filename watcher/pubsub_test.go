@@ -0,0 +1,227 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testTopic     = "zync-test"
+	testOtherName = "k51qzi5uqu5dlnwjrnyyd6sl2i729d8qjv1bchfqpmgfeu8jn1w1p4q9x9uqit"
+)
+
+func TestLocalBroker(t *testing.T) {
+	broker := NewLocalBroker()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, err := broker.Subscribe(ctx, testTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := broker.Subscribe(ctx, testTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := broker.Subscribe(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := broker.Publish(ctx, testTopic, []byte("hello")); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for _, sub := range []<-chan []byte{first, second} {
+		select {
+		case data := <-sub:
+			if string(data) != "hello" {
+				t.Fatalf("received %q, want hello", data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the message")
+		}
+	}
+	select {
+	case data := <-other:
+		t.Fatalf("subscriber of another topic received %q", data)
+	default:
+	}
+
+	cancel()
+	for _, sub := range []<-chan []byte{first, second, other} {
+		select {
+		case _, ok := <-sub:
+			if ok {
+				t.Fatal("received a message after the subscription ended")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("subscription was not closed once its context was done")
+		}
+	}
+	eventually(t, "subscribers to be removed", func() bool {
+		return broker.subscriberCount(testTopic) == 0
+	})
+}
+
+func TestAnnouncementsApplyPublishedManifests(t *testing.T) {
+	_, sh := newFakeIPFS(t)
+	registry := newNameRegistry()
+	broker := NewLocalBroker()
+
+	publisher := newTestDatastore(t, sh, Settings{
+		Names:  registry.device(testName),
+		Broker: broker,
+		Topic:  testTopic,
+	})
+	go publisher.listenPublishes(publisher.published)
+
+	follower := newTestDatastore(t, sh, Settings{
+		Names:          registry.device(testOtherName),
+		Broker:         broker,
+		Topic:          testTopic,
+		Follow:         []string{testName},
+		FollowInterval: 5 * time.Second,
+	})
+	listenAnnouncements(t, follower, broker)
+
+	path := filepath.Join(t.TempDir(), "hello")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := publisher.AddFile(FilePath(path)); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	cid, _ := publisher.CID()
+
+	eventually(t, "the announced manifest to be applied", func() bool {
+		return follower.remoteCID(testName) == cid
+	})
+	follower.mux.RLock()
+	_, tracked := follower.store[FilePath(path)]
+	follower.mux.RUnlock()
+	if !tracked {
+		t.Fatalf("%s was not synced from the announced manifest", path)
+	}
+}
+
+func TestAnnouncementsIgnoreForgedManifests(t *testing.T) {
+	fake, sh := newFakeIPFS(t)
+	registry := newNameRegistry()
+	broker := NewLocalBroker()
+
+	follower := newTestDatastore(t, sh, Settings{
+		Broker:         broker,
+		Topic:          testTopic,
+		Names:          registry.device(testOtherName),
+		Follow:         []string{testName},
+		FollowInterval: 5 * time.Second,
+	})
+	listenAnnouncements(t, follower, broker)
+
+	dir := t.TempDir()
+	forgedPath := filepath.Join(dir, "forged")
+	forged := putManifest(t, fake, map[string]string{forgedPath: "forged"})
+	genuinePath := filepath.Join(dir, "genuine")
+	genuine := putManifest(t, fake, map[string]string{genuinePath: "genuine"})
+	registry.set(testName, genuine)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := follower.Subscribe(ctx)
+
+	// the forged manifest is announced under the followed name, which
+	// points elsewhere, and then under a name that is not followed
+	announce(t, broker, testName, forged)
+	announce(t, broker, testOtherName, forged)
+	// announcements are applied in order, so once the genuine one is
+	// applied the forged ones have been handled
+	announce(t, broker, testName, genuine)
+
+	eventually(t, "the genuine manifest to be applied", func() bool {
+		return follower.remoteCID(testName) == genuine
+	})
+	if _, err := os.Stat(genuinePath); err != nil {
+		t.Fatalf("genuine file was not synced: %v", err)
+	}
+	if _, err := os.Stat(forgedPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("forged file was synced: %v", err)
+	}
+	for {
+		select {
+		case event := <-events:
+			if event.AbsolutePath == FilePath(forgedPath) {
+				t.Fatalf("forged file was synced: %s event", event.Type)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// listenAnnouncements starts listening for the announcements of d,
+// returning once it is subscribed
+func listenAnnouncements(t *testing.T, d *Datastore, broker *LocalBroker) {
+	t.Helper()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go d.listenAnnouncements(d.Settings(), stop)
+	eventually(t, "the subscription", func() bool {
+		return broker.subscriberCount(d.Settings().Topic) > 0
+	})
+}
+
+func announce(t *testing.T, broker Broker, name string, cid CID) {
+	t.Helper()
+	b, err := json.Marshal(announcement{Name: name, CID: cid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Publish(context.Background(), testTopic, b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// putManifest stores the files, keyed by path, and a manifest holding
+// them on the fake node, returning the CID of the manifest
+func putManifest(t *testing.T, fake *fakeIPFS, contents map[string]string) CID {
+	t.Helper()
+	files := make(store)
+	for path, content := range contents {
+		sum := sha256.Sum256([]byte(content))
+		files[FilePath(path)] = &File{
+			CID:          CID(fake.put([]byte(content), true, true)),
+			AbsolutePath: FilePath(path),
+			Sum:          hex.EncodeToString(sum[:]),
+			Size:         int64(len(content)),
+			ModTime:      time.Now(),
+		}
+	}
+	b, err := json.Marshal(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CID(fake.put(b, true, true))
+}
+
+func (b *LocalBroker) subscriberCount(topic string) int {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return len(b.subscribers[topic])
+}
+
+func (d *Datastore) remoteCID(name string) CID {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	if r, ok := d.remotes[name]; ok {
+		return r.CID
+	}
+	return ""
+}
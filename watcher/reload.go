@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// Reload applies new settings and IPFS API client to the running
+// datastore, returning a description of each setting that changed
+func (d *Datastore) Reload(sh *shell.Shell, settings Settings) []string {
+	d.settingsMux.Lock()
+	old := d.settings
+	changes := diffSettings(old, settings)
+	d.sh = sh
+	d.settings = settings
+
+	// restart the listeners of followed manifests when anything they
+	// were started with changes. The broker is replaced on every reload,
+	// so only restart when it now talks to a different backend
+	if d.following != nil && (!reflect.DeepEqual(old.Follow, settings.Follow) ||
+		old.FollowInterval != settings.FollowInterval ||
+		old.Backend != settings.Backend ||
+		(old.Broker == nil) != (settings.Broker == nil) ||
+		old.Topic != settings.Topic) {
+		close(d.following)
+		d.following = d.follow(settings)
+	}
+	if d.scheduling != nil && !reflect.DeepEqual(old.Schedules, settings.Schedules) {
+		close(d.scheduling)
+		d.scheduling = d.schedule(settings)
+	}
+	d.settingsMux.Unlock()
+
+	if old.RefreshInterval != settings.RefreshInterval {
+		d.rewatch()
+	}
+
+	return changes
+}
+
+// follow starts listening for changes to followed manifests, returning
+// the channel that stops the listeners when closed
+func (d *Datastore) follow(settings Settings) chan struct{} {
+	stop := make(chan struct{})
+	for _, name := range settings.Follow {
+		go d.listenRemote(name, settings.FollowInterval, stop)
+	}
+	if settings.Broker != nil && settings.Topic != "" {
+		go d.listenAnnouncements(settings, stop)
+	}
+	return stop
+}
+
+// rewatch restarts the watchers of all stored files so that they check
+// for changes at the current refresh interval
+func (d *Datastore) rewatch() {
+	var files []*File
+	d.RangeStore(func(file *File) (done bool) {
+		if file.Watcher != nil {
+			files = append(files, file)
+		}
+		return false
+	})
+	for _, file := range files {
+		file.Watcher.Stop()
+		d.watch(file)
+	}
+}
+
+func diffSettings(prev, next Settings) []string {
+	var changes []string
+	changed := func(name string, from, to interface{}) {
+		changes = append(changes, fmt.Sprintf("%s changed from %v to %v", name, from, to))
+	}
+	if prev.BackupLocation != next.BackupLocation {
+		changed("backup location", quote(prev.BackupLocation), quote(next.BackupLocation))
+	}
+	if prev.RefreshInterval != next.RefreshInterval {
+		changed("refresh interval", prev.RefreshInterval, next.RefreshInterval)
+	}
+	if prev.ConflictPolicy != next.ConflictPolicy {
+		changed("conflict policy", prev.ConflictPolicy, next.ConflictPolicy)
+	}
+	if prev.Backend != next.Backend {
+		changed("backend", quote(prev.Backend), quote(next.Backend))
+	}
+	if !reflect.DeepEqual(prev.Follow, next.Follow) {
+		changed("followed names", prev.Follow, next.Follow)
+	}
+	if prev.FollowInterval != next.FollowInterval {
+		changed("follow interval", prev.FollowInterval, next.FollowInterval)
+	}
+	if prev.DeleteRemoved != next.DeleteRemoved {
+		changed("deleting removed files", prev.DeleteRemoved, next.DeleteRemoved)
+	}
+	if describeNames(prev.Names) != describeNames(next.Names) {
+		changed("name publishing", describeNames(prev.Names), describeNames(next.Names))
+	}
+	if prev.Topic != next.Topic {
+		changed("pubsub topic", quote(prev.Topic), quote(next.Topic))
+	}
+	if !reflect.DeepEqual(prev.Schedules, next.Schedules) {
+		changed("snapshot schedules", describeSchedules(prev.Schedules), describeSchedules(next.Schedules))
+	}
+	return changes
+}
+
+func describeNames(names Names) string {
+	switch n := names.(type) {
+	case nil:
+		return "disabled"
+	case *IPNS:
+		return fmt.Sprintf("ipns key %q", n.key)
+	default:
+		return fmt.Sprintf("%T", n)
+	}
+}
+
+func describeSchedules(schedules []Schedule) string {
+	if len(schedules) == 0 {
+		return "none"
+	}
+	described := make([]string, 0, len(schedules))
+	for _, schedule := range schedules {
+		described = append(described, schedule.String())
+	}
+	return strings.Join(described, ", ")
+}
+
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
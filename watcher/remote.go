@@ -0,0 +1,215 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// remote tracks the last manifest applied from a followed name. It is
+// the common ancestor used to tell local changes apart from remote ones
+type remote struct {
+	CID   CID `json:"cid"`
+	files store
+}
+
+func (d *Datastore) listenRemote(name string, interval time.Duration, stop chan struct{}) {
+	if err := d.loadRemotes(); err != nil {
+		log.WithField("op", "follow").WithError(err).Warn("could not load followed manifests")
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := d.Sync(ctx, name); err != nil {
+			log.WithFields(log.Fields{"name": name, "op": "sync"}).WithError(err).Error("could not sync")
+			d.emitError("", err)
+		}
+		cancel()
+
+		select {
+		case <-d.stop:
+			return
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// Sync fetches the newest manifest published under the given name and
+// applies any changes made since it was last synced. Files changed both
+// locally and remotely are resolved using the configured conflict policy
+func (d *Datastore) Sync(ctx context.Context, name string) error {
+
+	cid, err := d.names().Resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+	return d.apply(ctx, name, cid)
+}
+
+// apply brings the local files up to date with the manifest at the given
+// CID, which was published under the followed name
+func (d *Datastore) apply(ctx context.Context, name string, cid CID) error {
+
+	d.syncMux.Lock()
+	defer d.syncMux.Unlock()
+
+	var err error
+	d.mux.RLock()
+	base, ok := d.remotes[name]
+	d.mux.RUnlock()
+	if !ok {
+		base = &remote{}
+	}
+	if base.CID == cid {
+		return nil
+	}
+	if base.files == nil && base.CID != "" {
+		base.files, err = d.fetchManifest(ctx, base.CID)
+		if err != nil {
+			return err
+		}
+	}
+
+	files, err := d.fetchManifest(ctx, cid)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"cid": cid, "name": name, "op": "sync"}).Info("syncing manifest")
+	policy := d.Settings().ConflictPolicy
+	for path, file := range files {
+		file.AbsolutePath = path
+
+		d.mux.RLock()
+		tracked, isTracked := d.store[path]
+		d.mux.RUnlock()
+		if isTracked && tracked.CID == file.CID {
+			continue
+		}
+
+		ancestor, existed := base.files[path]
+		if existed && ancestor.CID == file.CID {
+			// only changed locally, which is published on its own
+			continue
+		}
+		if existed && (!isTracked || !exists(path)) {
+			// removed locally since it was last synced, which is a change
+			// like any other
+			log.WithFields(log.Fields{"path": path, "name": name, "op": "sync"}).Info("ignoring remote change to file removed locally")
+			continue
+		}
+
+		if isTracked && existed && tracked.CID == ancestor.CID {
+			log.WithFields(log.Fields{"path": path, "name": name, "op": "sync"}).Info("file changed remotely")
+			if _, err := d.download(ctx, file.CID, path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, _, err := d.restoreFile(ctx, file, policy); err != nil {
+			return err
+		}
+	}
+
+	for path, ancestor := range base.files {
+		if _, ok := files[path]; ok {
+			continue
+		}
+		d.mux.RLock()
+		tracked, isTracked := d.store[path]
+		d.mux.RUnlock()
+		if !isTracked || tracked.CID != ancestor.CID {
+			continue
+		}
+		log.WithFields(log.Fields{"path": path, "name": name, "op": "sync"}).Info("file removed remotely")
+		d.untrack(path)
+		// removing a file only stops it being tracked, so the local copy
+		// is kept unless deleting it was asked for
+		if !d.Settings().DeleteRemoved {
+			continue
+		}
+		if err := os.Remove(path.String()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	d.mux.Lock()
+	d.remotes[name] = &remote{CID: cid, files: files}
+	d.mux.Unlock()
+
+	if err := d.saveRemotes(); err != nil {
+		return err
+	}
+
+	return d.commit()
+}
+
+// exists reports whether there is a file at path
+func exists(path FilePath) bool {
+	_, err := os.Stat(path.String())
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+func (d *Datastore) fetchManifest(ctx context.Context, cid CID) (store, error) {
+	data, err := cat(ctx, d.shell(), cid.String())
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(store)
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, err
+	}
+	for path, file := range files {
+		file.AbsolutePath = path
+	}
+	return files, nil
+}
+
+func (d *Datastore) remotesLocation() string {
+	return d.Settings().BackupLocation + ".remotes"
+}
+
+func (d *Datastore) loadRemotes() error {
+	b, err := ioutil.ReadFile(d.remotesLocation())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	remotes := make(map[string]*remote)
+	if err := json.Unmarshal(b, &remotes); err != nil {
+		return err
+	}
+
+	d.mux.Lock()
+	for name, r := range remotes {
+		if _, ok := d.remotes[name]; !ok {
+			d.remotes[name] = r
+		}
+	}
+	d.mux.Unlock()
+	return nil
+}
+
+func (d *Datastore) saveRemotes() error {
+	d.mux.RLock()
+	b, err := json.Marshal(d.remotes)
+	d.mux.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.remotesLocation(), b, 0644)
+}
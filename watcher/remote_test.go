@@ -0,0 +1,86 @@
+package watcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyRemovedRemotely(t *testing.T) {
+	for _, deleteRemoved := range []bool{false, true} {
+		name := "keeps the file"
+		if deleteRemoved {
+			name = "deletes the file"
+		}
+		t.Run(name, func(t *testing.T) {
+			fake, sh := newFakeIPFS(t)
+			d := newTestDatastore(t, sh, Settings{DeleteRemoved: deleteRemoved})
+			ctx := context.Background()
+
+			path := filepath.Join(t.TempDir(), "notes")
+			if err := d.apply(ctx, testOtherName, putManifest(t, fake, map[string]string{path: "notes"})); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if !d.tracked(FilePath(path)) {
+				t.Fatal("synced file is not tracked")
+			}
+
+			if err := d.apply(ctx, testOtherName, putManifest(t, fake, map[string]string{})); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if d.tracked(FilePath(path)) {
+				t.Fatal("file removed remotely is still tracked")
+			}
+			if _, err := os.Stat(path); deleteRemoved != os.IsNotExist(err) {
+				t.Fatalf("file exists = %v with delete removed %v", err == nil, deleteRemoved)
+			}
+		})
+	}
+}
+
+func TestApplyRemovedLocally(t *testing.T) {
+	tests := []struct {
+		name string
+		// untrack is whether the removal was noticed before syncing
+		untrack bool
+	}{
+		{name: "noticed", untrack: true},
+		{name: "not yet noticed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, sh := newFakeIPFS(t)
+			d := newTestDatastore(t, sh, Settings{})
+			ctx := context.Background()
+
+			path := filepath.Join(t.TempDir(), "notes")
+			if err := d.apply(ctx, testOtherName, putManifest(t, fake, map[string]string{path: "before"})); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			if tt.untrack {
+				if err := d.RemoveFile(FilePath(path)); err != nil {
+					t.Fatalf("RemoveFile: %v", err)
+				}
+			}
+
+			if err := d.apply(ctx, testOtherName, putManifest(t, fake, map[string]string{path: "changed remotely"})); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+			if b, err := ioutil.ReadFile(path); err == nil {
+				t.Fatalf("file removed locally was brought back with %q", b)
+			}
+		})
+	}
+}
+
+func (d *Datastore) tracked(path FilePath) bool {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	_, ok := d.store[path]
+	return ok
+}
@@ -0,0 +1,315 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ManualLabel labels the snapshots taken by Backup when no label is given
+const ManualLabel = "manual"
+
+// Schedule takes snapshots labeled with Label at the times of Cron, and
+// decides how long snapshots with the label are retained
+type Schedule struct {
+	Label string
+	// Cron is when snapshots are taken. Schedules without one only set
+	// the retention of snapshots taken by hand with the label
+	Cron *Cron
+	// Keep is how many of the newest snapshots are retained, or every
+	// snapshot when zero
+	Keep int
+	// MaxAge is how long snapshots are retained, or forever when zero
+	MaxAge time.Duration
+}
+
+func (s Schedule) String() string {
+	var b strings.Builder
+	b.WriteString(s.Label)
+	if s.Cron != nil {
+		fmt.Fprintf(&b, " at %q", s.Cron)
+	}
+	if s.Keep > 0 {
+		fmt.Fprintf(&b, " keeping %d", s.Keep)
+	}
+	if s.MaxAge > 0 {
+		fmt.Fprintf(&b, " for %s", s.MaxAge)
+	}
+	return b.String()
+}
+
+// Status returns the RPC format for the Snapshot
+func (s Snapshot) Status() *zync.Snapshot {
+	return &zync.Snapshot{
+		Cid:     s.CID.String(),
+		Label:   s.Label,
+		TakenAt: timestamppb.New(s.CommittedAt),
+		Files:   int64(s.Files),
+		Size:    s.Size,
+	}
+}
+
+func (d *Datastore) snapshotsLocation() string {
+	return d.Settings().BackupLocation + ".snapshots"
+}
+
+func (d *Datastore) loadSnapshots() error {
+	b, err := ioutil.ReadFile(d.snapshotsLocation())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var snapshots []Snapshot
+	if err := json.Unmarshal(b, &snapshots); err != nil {
+		return err
+	}
+
+	d.mux.Lock()
+	d.snapshots = snapshots
+	d.mux.Unlock()
+	return nil
+}
+
+func (d *Datastore) saveSnapshots() error {
+	d.mux.RLock()
+	b, err := json.Marshal(d.snapshots)
+	d.mux.RUnlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.snapshotsLocation(), b, 0644)
+}
+
+// Backup commits the files in the datastore and keeps the manifest as a
+// snapshot with the given label, or ManualLabel when empty. Snapshots
+// with the label that are no longer retained by its schedule are then
+// released
+func (d *Datastore) Backup(label string) (Snapshot, error) {
+	if label == "" {
+		label = ManualLabel
+	}
+
+	// followed manifests are applied under the same lock, so snapshots
+	// never hold half of one
+	d.syncMux.Lock()
+	err := d.commit()
+	cid, _ := d.CID()
+	b, jsonErr := d.JSON()
+	d.syncMux.Unlock()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if jsonErr != nil {
+		return Snapshot{}, jsonErr
+	}
+
+	d.mux.Lock()
+	snapshot := Snapshot{
+		CID:         cid,
+		CommittedAt: time.Now(),
+		Files:       len(d.store),
+		Size:        int64(len(b)),
+		Label:       label,
+	}
+	d.snapshots = append(d.snapshots, snapshot)
+	d.mux.Unlock()
+
+	if err := d.saveSnapshots(); err != nil {
+		return snapshot, err
+	}
+	log.WithFields(log.Fields{"cid": cid, "label": label, "files": snapshot.Files, "op": "backup"}).
+		Info("took snapshot")
+
+	return snapshot, d.prune(d.Settings().Schedules)
+}
+
+// Snapshots returns the snapshots taken by Backup with the given label,
+// or with any label when empty, newest first
+func (d *Datastore) Snapshots(label string) []Snapshot {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	var snapshots []Snapshot
+	for i := len(d.snapshots) - 1; i >= 0; i-- {
+		if label == "" || d.snapshots[i].Label == label {
+			snapshots = append(snapshots, d.snapshots[i])
+		}
+	}
+	return snapshots
+}
+
+// prune releases the snapshots that are no longer retained by the
+// schedules of their labels. The manifests of released snapshots, and
+// the files only they hold, are unpinned unless something else still
+// refers to them
+func (d *Datastore) prune(schedules []Schedule) error {
+	retention := make(map[string]Schedule)
+	for _, schedule := range schedules {
+		retention[schedule.Label] = schedule
+	}
+
+	now := time.Now()
+	d.mux.Lock()
+	var kept, released []Snapshot
+	newer := make(map[string]int)
+	for i := len(d.snapshots) - 1; i >= 0; i-- {
+		snapshot := d.snapshots[i]
+		schedule, ok := retention[snapshot.Label]
+		newer[snapshot.Label]++
+		if ok && ((schedule.Keep > 0 && newer[snapshot.Label] > schedule.Keep) ||
+			(schedule.MaxAge > 0 && now.Sub(snapshot.CommittedAt) > schedule.MaxAge)) {
+			released = append(released, snapshot)
+			continue
+		}
+		kept = append(kept, snapshot)
+	}
+	if len(released) == 0 {
+		d.mux.Unlock()
+		return nil
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].CommittedAt.Before(kept[j].CommittedAt)
+	})
+	d.snapshots = kept
+	d.mux.Unlock()
+
+	if err := d.saveSnapshots(); err != nil {
+		return err
+	}
+
+	cids := make([]CID, 0, len(released))
+	for _, snapshot := range released {
+		log.WithFields(log.Fields{"cid": snapshot.CID, "label": snapshot.Label, "op": "prune"}).Info("released snapshot")
+		cids = append(cids, snapshot.CID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := d.release(ctx, cids, log.Fields{"op": "prune"}); err != nil {
+		return fmt.Errorf("could not unpin released snapshots: %w", err)
+	}
+	return nil
+}
+
+// retained reports whether the manifest at cid is the current manifest,
+// is in the history, is held by a retained snapshot or is named by a tag
+func (d *Datastore) retained(cid CID) bool {
+	d.mux.RLock()
+	held := d.cid == cid
+	for _, snapshot := range d.history {
+		held = held || snapshot.CID == cid
+	}
+	for _, snapshot := range d.snapshots {
+		held = held || snapshot.CID == cid
+	}
+	d.mux.RUnlock()
+	return held || d.tagged(cid)
+}
+
+// referenced returns the CIDs of the files that are tracked, in
+// conflict, last applied from a followed name or held by a retained
+// manifest
+func (d *Datastore) referenced(ctx context.Context) (map[CID]bool, error) {
+	refs := make(map[CID]bool)
+	d.mux.RLock()
+	manifests := []CID{d.cid}
+	for _, snapshot := range d.history {
+		manifests = append(manifests, snapshot.CID)
+	}
+	for _, snapshot := range d.snapshots {
+		manifests = append(manifests, snapshot.CID)
+	}
+	for _, file := range d.store {
+		file.mux.RLock()
+		refs[file.CID] = true
+		file.mux.RUnlock()
+	}
+	for _, conflict := range d.conflicts {
+		refs[conflict.LocalCID] = true
+		refs[conflict.RemoteCID] = true
+	}
+	for _, remote := range d.remotes {
+		for _, file := range remote.files {
+			refs[file.CID] = true
+		}
+	}
+	d.mux.RUnlock()
+
+	tags, err := d.loadTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		manifests = append(manifests, tag.CID)
+	}
+
+	seen := make(map[CID]bool)
+	for _, cid := range manifests {
+		if cid == "" || seen[cid] {
+			continue
+		}
+		seen[cid] = true
+		files, err := d.Manifest(ctx, cid)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			refs[file.CID] = true
+		}
+	}
+	return refs, nil
+}
+
+// schedule starts taking the snapshots of every schedule with a cron
+// expression, returning the channel that stops them when closed. The
+// retention of the schedules is applied right away, as it may have
+// changed
+func (d *Datastore) schedule(settings Settings) chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		if err := d.prune(settings.Schedules); err != nil {
+			log.WithField("op", "prune").WithError(err).Error("could not release snapshots")
+		}
+	}()
+	for _, schedule := range settings.Schedules {
+		if schedule.Cron != nil {
+			go d.takeSnapshots(schedule, stop)
+		}
+	}
+	return stop
+}
+
+func (d *Datastore) takeSnapshots(schedule Schedule, stop chan struct{}) {
+	for {
+		next := schedule.Cron.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-d.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := d.Backup(schedule.Label); err != nil {
+			log.WithFields(log.Fields{"label": schedule.Label, "op": "backup"}).WithError(err).
+				Error("could not take scheduled snapshot")
+			d.emitError("", err)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneUnpins(t *testing.T) {
+	tests := []struct {
+		name string
+		// dropHistory forgets the history before the second snapshot, as
+		// if it had grown past maxHistory
+		dropHistory bool
+		wantPinned  bool
+	}{
+		{name: "in the history", wantPinned: true},
+		{name: "dropped from the history", dropHistory: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, sh := newFakeIPFS(t)
+			d := newTestDatastore(t, sh, Settings{Schedules: []Schedule{{Label: "daily", Keep: 1}}})
+
+			dir := t.TempDir()
+			write := func(name, contents string) CID {
+				t.Helper()
+				path := filepath.Join(dir, name)
+				if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := d.AddFile(FilePath(path)); err != nil {
+					t.Fatalf("AddFile: %v", err)
+				}
+				return CID(fake.put([]byte(contents), false, false))
+			}
+
+			shared := write("shared", "shared")
+			first := write("notes", "first")
+			released, err := d.Backup("daily")
+			if err != nil {
+				t.Fatalf("Backup: %v", err)
+			}
+			second := write("notes", "second")
+			if tt.dropHistory {
+				d.mux.Lock()
+				d.history = nil
+				d.mux.Unlock()
+			}
+			kept, err := d.Backup("daily")
+			if err != nil {
+				t.Fatalf("Backup: %v", err)
+			}
+
+			if snapshots := d.Snapshots("daily"); len(snapshots) != 1 || snapshots[0].CID != kept.CID {
+				t.Fatalf("snapshots = %v, want only %s", snapshots, kept.CID)
+			}
+			if fake.pinned(released.CID) != tt.wantPinned {
+				t.Fatalf("released manifest pinned = %v, want %v", !tt.wantPinned, tt.wantPinned)
+			}
+			if fake.pinned(first) != tt.wantPinned {
+				t.Fatalf("file only held by the released manifest pinned = %v, want %v", !tt.wantPinned, tt.wantPinned)
+			}
+			for what, cid := range map[string]CID{"kept manifest": kept.CID, "tracked file": second, "shared file": shared} {
+				if !fake.pinned(cid) {
+					t.Fatalf("%s %s was unpinned", what, cid)
+				}
+			}
+		})
+	}
+}
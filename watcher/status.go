@@ -0,0 +1,188 @@
+package watcher
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxRetryInterval caps the backoff between attempts to upload a file
+// that previously failed
+const maxRetryInterval = 5 * time.Minute
+
+// FileError records the last error encountered while storing a file
+type FileError struct {
+	AbsolutePath FilePath
+	Err          error
+	Time         time.Time
+	Attempts     int
+	nextAttempt  time.Time
+}
+
+// Status returns the RPC format for the FileError
+func (e *FileError) Status() *zync.FileError {
+	return &zync.FileError{
+		AbsolutePath: e.AbsolutePath.String(),
+		Error:        e.Err.Error(),
+		Time:         timestamppb.New(e.Time),
+		Attempts:     int32(e.Attempts),
+	}
+}
+
+// The states a file managed by the datastore can be in
+const (
+	// FileSynced means the stored CID reflects the last read of the file
+	FileSynced = "synced"
+	// FileConflict means the file has an unresolved conflict
+	FileConflict = "conflict"
+	// FileRetrying means storing the file failed and will be retried
+	FileRetrying = "retrying"
+	// FileUntracked means the file is no longer managed
+	FileUntracked = "untracked"
+)
+
+// FileStatus returns the RPC format for the file along with the state
+// it is in within the datastore
+func (d *Datastore) FileStatus(file *File) *zync.File {
+	status := file.Status()
+
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	_, tracked := d.store[file.AbsolutePath]
+	_, conflict := d.conflicts[file.AbsolutePath]
+	_, failed := d.failures[file.AbsolutePath]
+	switch {
+	case !tracked:
+		status.Status = FileUntracked
+	case conflict:
+		status.Status = FileConflict
+	case failed:
+		status.Status = FileRetrying
+	default:
+		status.Status = FileSynced
+	}
+	return status
+}
+
+// Stats summarizes the state of the datastore
+type Stats struct {
+	Files          int
+	TotalSize      int64
+	PendingUploads int64
+	QueuedRetries  int
+	LastCommit     time.Time
+	Errors         []FileError
+}
+
+// Stats returns a summary of the files managed by the datastore and the
+// work it has yet to do
+func (d *Datastore) Stats() Stats {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	stats := Stats{
+		Files:          len(d.store),
+		PendingUploads: atomic.LoadInt64(&d.uploading),
+		QueuedRetries:  len(d.failures),
+		LastCommit:     d.committedAt,
+	}
+	for _, file := range d.store {
+		stats.TotalSize += file.Size
+	}
+	for _, failure := range d.failures {
+		stats.Errors = append(stats.Errors, *failure)
+	}
+	return stats
+}
+
+// Ping reports whether the IPFS API can be reached
+func (d *Datastore) Ping(ctx context.Context) error {
+	var version struct{ Version string }
+	return d.shell().Request("version").Exec(ctx, &version)
+}
+
+// fail records the error for the file and queues another attempt to
+// store it, backing off exponentially with every failure
+func (d *Datastore) fail(path FilePath, err error) {
+	log.WithFields(log.Fields{"path": path, "op": "store"}).WithError(err).Error("could not store file")
+	d.emitError(path, err)
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	failure, ok := d.failures[path]
+	if !ok {
+		failure = &FileError{AbsolutePath: path}
+		d.failures[path] = failure
+	}
+	failure.Err = err
+	failure.Time = time.Now()
+	failure.Attempts++
+
+	backoff := d.Settings().RefreshInterval << uint(failure.Attempts-1)
+	if backoff <= 0 || backoff > maxRetryInterval {
+		backoff = maxRetryInterval
+	}
+	failure.nextAttempt = failure.Time.Add(backoff)
+}
+
+// succeed clears any error recorded for the file
+func (d *Datastore) succeed(path FilePath) {
+	d.mux.Lock()
+	delete(d.failures, path)
+	d.mux.Unlock()
+}
+
+func (d *Datastore) listenRetries() {
+	interval := d.Settings().RefreshInterval
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-tick.C:
+			// pick up changes to the refresh interval made by Reload
+			if refresh := d.Settings().RefreshInterval; refresh != interval {
+				interval = refresh
+				tick.Reset(interval)
+			}
+
+			var due []FilePath
+			d.mux.RLock()
+			for path, failure := range d.failures {
+				if !now.Before(failure.nextAttempt) {
+					due = append(due, path)
+				}
+			}
+			d.mux.RUnlock()
+
+			for _, path := range due {
+				d.retry(path)
+			}
+		}
+	}
+}
+
+func (d *Datastore) retry(path FilePath) {
+	d.mux.RLock()
+	_, tracked := d.store[path]
+	d.mux.RUnlock()
+
+	if tracked {
+		if _, err := d.AddFile(path); err != nil {
+			d.fail(path, err)
+			return
+		}
+	} else if err := d.RemoveFile(path); err != nil {
+		d.fail(path, err)
+		return
+	}
+	d.succeed(path)
+}
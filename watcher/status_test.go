@@ -0,0 +1,128 @@
+package watcher
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStatus(t *testing.T) {
+	_, sh := newFakeIPFS(t)
+	d := newTestDatastore(t, sh, Settings{})
+
+	dir := t.TempDir()
+	add := func(name string) *File {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := d.AddFile(FilePath(path))
+		if err != nil {
+			t.Fatalf("AddFile: %v", err)
+		}
+		return file
+	}
+
+	synced, conflict, retrying, untracked := add("synced"), add("conflict"), add("retrying"), add("untracked")
+	d.mux.Lock()
+	d.conflicts[conflict.AbsolutePath] = &Conflict{AbsolutePath: conflict.AbsolutePath}
+	d.mux.Unlock()
+	d.fail(retrying.AbsolutePath, errors.New("add failed"))
+	if err := d.RemoveFile(untracked.AbsolutePath); err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+
+	for file, want := range map[*File]string{
+		synced:    FileSynced,
+		conflict:  FileConflict,
+		retrying:  FileRetrying,
+		untracked: FileUntracked,
+	} {
+		if got := d.FileStatus(file).Status; got != want {
+			t.Errorf("status of %s = %q, want %q", file.AbsolutePath, got, want)
+		}
+	}
+
+	stats := d.Stats()
+	if stats.Files != 3 || stats.TotalSize != int64(len("synced")+len("conflict")+len("retrying")) {
+		t.Fatalf("stats hold %d files of %d bytes, want 3 files of %d bytes",
+			stats.Files, stats.TotalSize, len("synced")+len("conflict")+len("retrying"))
+	}
+	if stats.QueuedRetries != 1 || len(stats.Errors) != 1 || stats.Errors[0].AbsolutePath != retrying.AbsolutePath {
+		t.Fatalf("stats queue %d retries with errors %v, want one for %s", stats.QueuedRetries, stats.Errors, retrying.AbsolutePath)
+	}
+	if stats.LastCommit.IsZero() {
+		t.Fatal("stats hold no commit")
+	}
+}
+
+func TestFailBacksOff(t *testing.T) {
+	_, sh := newFakeIPFS(t)
+	d := newTestDatastore(t, sh, Settings{RefreshInterval: time.Minute})
+	path := FilePath(filepath.Join(t.TempDir(), "notes"))
+
+	// the backoff doubles from the refresh interval up to maxRetryInterval
+	for attempt, want := range []time.Duration{
+		time.Minute,
+		2 * time.Minute,
+		4 * time.Minute,
+		maxRetryInterval,
+		maxRetryInterval,
+	} {
+		d.fail(path, errors.New("add failed"))
+
+		d.mux.RLock()
+		failure := *d.failures[path]
+		d.mux.RUnlock()
+		if failure.Attempts != attempt+1 {
+			t.Fatalf("attempts = %d, want %d", failure.Attempts, attempt+1)
+		}
+		if backoff := failure.nextAttempt.Sub(failure.Time); backoff != want {
+			t.Fatalf("backoff after %d attempts = %v, want %v", failure.Attempts, backoff, want)
+		}
+	}
+
+	d.succeed(path)
+	if stats := d.Stats(); stats.QueuedRetries != 0 {
+		t.Fatalf("%d retries queued after succeeding, want none", stats.QueuedRetries)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	fake, sh := newFakeIPFS(t)
+	d := newTestDatastore(t, sh, Settings{RefreshInterval: time.Minute})
+
+	path := filepath.Join(t.TempDir(), "notes")
+	if err := ioutil.WriteFile(path, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := d.AddFile(FilePath(path))
+	if err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	d.fail(file.AbsolutePath, errors.New("add failed"))
+
+	// a retry that fails again backs off further
+	fake.mux.Lock()
+	fake.failAdds = true
+	fake.mux.Unlock()
+	d.retry(file.AbsolutePath)
+	d.mux.RLock()
+	failure := *d.failures[file.AbsolutePath]
+	d.mux.RUnlock()
+	if failure.Attempts != 2 || failure.nextAttempt.Sub(failure.Time) != 2*time.Minute {
+		t.Fatalf("failed retry made %d attempts backing off %v, want 2 attempts backing off 2m",
+			failure.Attempts, failure.nextAttempt.Sub(failure.Time))
+	}
+
+	fake.mux.Lock()
+	fake.failAdds = false
+	fake.mux.Unlock()
+	d.retry(file.AbsolutePath)
+	if got := d.FileStatus(file).Status; got != FileSynced {
+		t.Fatalf("status after retrying = %q, want %q", got, FileSynced)
+	}
+}
@@ -0,0 +1,278 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+	gocid "github.com/ipfs/go-cid"
+	shell "github.com/ipfs/go-ipfs-api"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TagsPath is where the tags are kept in the mutable file system of the
+// IPFS node, so they live as long as the backups they name and are never
+// garbage collected by the node
+const TagsPath = "/zync/tags.json"
+
+// tagName restricts tag names so they are never mistaken for paths
+var tagName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Tag is a name given to a manifest
+type Tag struct {
+	Name     string    `json:"name"`
+	CID      CID       `json:"cid"`
+	TaggedAt time.Time `json:"tagged_at"`
+}
+
+// Status returns the RPC format for the Tag
+func (t Tag) Status() *zync.Tag {
+	return &zync.Tag{
+		Name:     t.Name,
+		Cid:      t.CID.String(),
+		TaggedAt: timestamppb.New(t.TaggedAt),
+	}
+}
+
+// ValidateTagName checks that name can be used as a tag. Names that
+// could be read as a CID are refused, as the CID would win
+func ValidateTagName(name string) error {
+	if !tagName.MatchString(name) {
+		return fmt.Errorf("invalid tag name %q, must be letters, digits, '.', '_' or '-'", name)
+	}
+	if _, err := gocid.Decode(name); err == nil {
+		return fmt.Errorf("invalid tag name %q, it is a CID", name)
+	}
+	return nil
+}
+
+// Tags returns every tag in order of name
+func (d *Datastore) Tags(ctx context.Context) ([]Tag, error) {
+	tags, err := d.loadTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sortTags(tags), nil
+}
+
+// AddTag names the manifest at cid, or the current manifest when empty.
+// The manifest is pinned for as long as it is tagged. An existing tag is
+// only moved to another manifest when force is set
+func (d *Datastore) AddTag(ctx context.Context, name string, cid CID, force bool) (Tag, error) {
+	if err := ValidateTagName(name); err != nil {
+		return Tag{}, err
+	}
+	if cid == "" {
+		var ok bool
+		if cid, ok = d.CID(); !ok {
+			return Tag{}, fmt.Errorf("nothing has been backed up yet")
+		}
+	}
+
+	d.tagsMux.Lock()
+	defer d.tagsMux.Unlock()
+	tags, err := d.loadTags(ctx)
+	if err != nil {
+		return Tag{}, err
+	}
+	previous, exists := tags[name]
+	if exists && previous.CID != cid && !force {
+		return Tag{}, fmt.Errorf("tag %s already names %s", name, previous.CID)
+	}
+
+	if err := d.shell().Pin(cid.String()); err != nil {
+		return Tag{}, err
+	}
+	tag := Tag{Name: name, CID: cid, TaggedAt: time.Now()}
+	tags[name] = tag
+	if err := d.saveTags(ctx, tags); err != nil {
+		return Tag{}, err
+	}
+	log.WithFields(log.Fields{"cid": cid, "tag": name, "op": "tag"}).Info("tagged manifest")
+
+	if exists && previous.CID != cid {
+		fields := log.Fields{"tag": name, "op": "tag"}
+		if err := d.release(ctx, []CID{previous.CID}, fields); err != nil {
+			log.WithFields(fields).WithError(err).Warn("could not release manifest")
+		}
+	}
+	return tag, nil
+}
+
+// RemoveTag removes the tag with the given name, unpinning its manifest
+// unless something else still refers to it
+func (d *Datastore) RemoveTag(ctx context.Context, name string) (Tag, error) {
+	d.tagsMux.Lock()
+	defer d.tagsMux.Unlock()
+	tags, err := d.loadTags(ctx)
+	if err != nil {
+		return Tag{}, err
+	}
+	tag, ok := tags[name]
+	if !ok {
+		return Tag{}, fmt.Errorf("tag %s does not exist", name)
+	}
+	delete(tags, name)
+	if err := d.saveTags(ctx, tags); err != nil {
+		return Tag{}, err
+	}
+	log.WithFields(log.Fields{"cid": tag.CID, "tag": name, "op": "untag"}).Info("removed tag")
+
+	fields := log.Fields{"tag": name, "op": "untag"}
+	if err := d.release(ctx, []CID{tag.CID}, fields); err != nil {
+		log.WithFields(fields).WithError(err).Warn("could not release manifest")
+	}
+	return tag, nil
+}
+
+// release unpins the manifests at cids that nothing refers to anymore,
+// along with the files they hold that are not tracked, in conflict or
+// held by a retained manifest. Manifests that cannot be read stay
+// pinned, as their files are not known
+func (d *Datastore) release(ctx context.Context, cids []CID, fields log.Fields) error {
+	var errs []string
+	var files []CID
+	released := make(map[CID]bool)
+	for _, cid := range cids {
+		if released[cid] {
+			continue
+		}
+		if d.retained(cid) {
+			log.WithFields(fields).WithField("cid", cid).Debug("manifest is still in use")
+			continue
+		}
+		manifest, err := d.Manifest(ctx, cid)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("could not read manifest %s: %v", cid, err))
+			continue
+		}
+		if err := d.unpin(cid); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		released[cid] = true
+		log.WithFields(fields).WithField("cid", cid).Info("released manifest")
+
+		for _, file := range manifest {
+			files = append(files, file.CID)
+		}
+		d.mux.Lock()
+		delete(d.manifests, cid)
+		d.mux.Unlock()
+	}
+
+	if len(files) > 0 {
+		referenced, err := d.referenced(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("could not release files: %v", err))
+			files = nil
+		}
+		for _, cid := range files {
+			if referenced[cid] || released[cid] {
+				continue
+			}
+			released[cid] = true
+			if err := d.unpin(cid); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			log.WithFields(fields).WithField("cid", cid).Debug("released file")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// unpin unpins the cid, which may already be unpinned
+func (d *Datastore) unpin(cid CID) error {
+	if err := d.shell().Unpin(cid.String()); err != nil && !strings.Contains(err.Error(), "not pinned") {
+		return fmt.Errorf("could not unpin %s: %w", cid, err)
+	}
+	return nil
+}
+
+// tagged reports whether the manifest at cid is named by a tag. Tags
+// that cannot be read count as naming every manifest, so nothing is
+// released that might still be tagged
+func (d *Datastore) tagged(cid CID) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tags, err := d.loadTags(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{"cid": cid, "op": "tags"}).WithError(err).
+			Warn("could not read tags, keeping manifest")
+		return true
+	}
+	for _, tag := range tags {
+		if tag.CID == cid {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTags reads the tags from the IPFS node, keyed by name
+func (d *Datastore) loadTags(ctx context.Context) (map[string]Tag, error) {
+	tags := make(map[string]Tag)
+	r, err := d.shell().FilesRead(ctx, TagsPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			return tags, nil
+		}
+		return nil, fmt.Errorf("could not read tags: %w", err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tags: %w", err)
+	}
+
+	var list []Tag
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("could not read tags: %w", err)
+	}
+	for _, tag := range list {
+		tags[tag.Name] = tag
+	}
+	return tags, nil
+}
+
+// saveTags replaces the tags kept on the IPFS node
+func (d *Datastore) saveTags(ctx context.Context, tags map[string]Tag) error {
+	b, err := json.Marshal(sortTags(tags))
+	if err != nil {
+		return err
+	}
+	err = d.shell().FilesWrite(ctx, TagsPath, bytes.NewReader(b),
+		shell.FilesWrite.Create(true),
+		shell.FilesWrite.Parents(true),
+		shell.FilesWrite.Truncate(true),
+	)
+	if err != nil {
+		return fmt.Errorf("could not save tags: %w", err)
+	}
+	return nil
+}
+
+func sortTags(tags map[string]Tag) []Tag {
+	list := make([]Tag, 0, len(tags))
+	for _, tag := range tags {
+		list = append(list, tag)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
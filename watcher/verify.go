@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dnjp/zync/proto/zync/v1"
+)
+
+// Verification reports whether a file can be restored from its stored
+// CID and whether the local copy has diverged from it
+type Verification struct {
+	AbsolutePath    FilePath
+	CID             CID
+	Checksum        string
+	Retrievable     bool
+	Pinned          bool
+	ChecksumMatches bool
+	LocalExists     bool
+	LocalDiverged   bool
+	Errors          []error
+}
+
+// OK reports whether the stored copy of the file is restorable
+func (v *Verification) OK() bool {
+	return v.Retrievable && v.Pinned && v.ChecksumMatches
+}
+
+// Status returns the RPC format for the Verification
+func (v *Verification) Status() *zync.Verification {
+	status := &zync.Verification{
+		AbsolutePath:    v.AbsolutePath.String(),
+		Cid:             v.CID.String(),
+		Checksum:        v.Checksum,
+		Retrievable:     v.Retrievable,
+		Pinned:          v.Pinned,
+		ChecksumMatches: v.ChecksumMatches,
+		LocalExists:     v.LocalExists,
+		LocalDiverged:   v.LocalDiverged,
+		Ok:              v.OK(),
+	}
+	for _, err := range v.Errors {
+		status.Errors = append(status.Errors, err.Error())
+	}
+	return status
+}
+
+// Verify checks that the stored CID of the file is pinned, can be
+// retrieved and matches the recorded checksum, and whether the local
+// copy of the file has diverged from it
+func (d *Datastore) Verify(ctx context.Context, file *File) *Verification {
+
+	file.mux.RLock()
+	v := &Verification{
+		AbsolutePath: file.AbsolutePath,
+		CID:          file.CID,
+		Checksum:     file.Sum,
+	}
+	file.mux.RUnlock()
+
+	var pin struct {
+		Keys map[string]struct{ Type string }
+	}
+	err := d.shell().Request("pin/ls", v.CID.String()).
+		Option("type", "recursive").
+		Exec(ctx, &pin)
+	if err != nil {
+		v.Errors = append(v.Errors, fmt.Errorf("cid is not pinned: %w", err))
+	} else {
+		v.Pinned = true
+	}
+
+	b, err := cat(ctx, d.shell(), v.CID.String())
+	if err != nil {
+		v.Errors = append(v.Errors, fmt.Errorf("cid is not retrievable: %w", err))
+	} else {
+		v.Retrievable = true
+		checksum := sha256.Sum256(b)
+		v.ChecksumMatches = hex.EncodeToString(checksum[:]) == v.Checksum
+		if !v.ChecksumMatches {
+			v.Errors = append(v.Errors, fmt.Errorf("retrieved contents do not match checksum %s", v.Checksum))
+		}
+	}
+
+	local, err := file.Checksum()
+	if errors.Is(err, os.ErrNotExist) {
+		v.LocalDiverged = true
+	} else if err != nil {
+		v.Errors = append(v.Errors, err)
+	} else {
+		v.LocalExists = true
+		v.LocalDiverged = hex.EncodeToString(local[:]) != v.Checksum
+	}
+
+	return v
+}
@@ -0,0 +1,113 @@
+package watcher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// checks are the results of a Verification
+type checks struct {
+	Retrievable, Pinned, ChecksumMatches, LocalExists, LocalDiverged bool
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// change breaks the stored or local copy of the file
+		change func(t *testing.T, fake *fakeIPFS, file *File)
+		want   checks
+	}{
+		{
+			name: "restorable",
+			want: checks{Retrievable: true, Pinned: true, ChecksumMatches: true, LocalExists: true},
+		},
+		{
+			name: "not pinned",
+			change: func(t *testing.T, fake *fakeIPFS, file *File) {
+				fake.mux.Lock()
+				delete(fake.pins, file.CID.String())
+				fake.mux.Unlock()
+			},
+			want: checks{Retrievable: true, ChecksumMatches: true, LocalExists: true},
+		},
+		{
+			name: "not retrievable",
+			change: func(t *testing.T, fake *fakeIPFS, file *File) {
+				fake.mux.Lock()
+				delete(fake.blocks, file.CID.String())
+				fake.mux.Unlock()
+			},
+			want: checks{Pinned: true, LocalExists: true},
+		},
+		{
+			name: "corrupted",
+			change: func(t *testing.T, fake *fakeIPFS, file *File) {
+				fake.mux.Lock()
+				fake.blocks[file.CID.String()] = []byte("corrupted")
+				fake.mux.Unlock()
+			},
+			want: checks{Retrievable: true, Pinned: true, LocalExists: true},
+		},
+		{
+			name: "edited locally",
+			change: func(t *testing.T, fake *fakeIPFS, file *File) {
+				if err := ioutil.WriteFile(file.AbsolutePath.String(), []byte("edited"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: checks{Retrievable: true, Pinned: true, ChecksumMatches: true, LocalExists: true, LocalDiverged: true},
+		},
+		{
+			name: "removed locally",
+			change: func(t *testing.T, fake *fakeIPFS, file *File) {
+				if err := os.Remove(file.AbsolutePath.String()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: checks{Retrievable: true, Pinned: true, ChecksumMatches: true, LocalDiverged: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, sh := newFakeIPFS(t)
+			d := newTestDatastore(t, sh, Settings{})
+
+			path := filepath.Join(t.TempDir(), "notes")
+			if err := ioutil.WriteFile(path, []byte("notes"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			file, err := d.AddFile(FilePath(path))
+			if err != nil {
+				t.Fatalf("AddFile: %v", err)
+			}
+			if tt.change != nil {
+				tt.change(t, fake, file)
+			}
+
+			v := d.Verify(context.Background(), file)
+			if v.AbsolutePath != file.AbsolutePath || v.CID != file.CID || v.Checksum != file.Sum {
+				t.Fatalf("verified %s at %s with checksum %s, want %s at %s with checksum %s",
+					v.AbsolutePath, v.CID, v.Checksum, file.AbsolutePath, file.CID, file.Sum)
+			}
+			got := checks{
+				Retrievable:     v.Retrievable,
+				Pinned:          v.Pinned,
+				ChecksumMatches: v.ChecksumMatches,
+				LocalExists:     v.LocalExists,
+				LocalDiverged:   v.LocalDiverged,
+			}
+			if got != tt.want {
+				t.Fatalf("Verify = %+v, want %+v", got, tt.want)
+			}
+			if wantOK := tt.want.Retrievable && tt.want.Pinned && tt.want.ChecksumMatches; v.OK() != wantOK || v.Status().Ok != wantOK {
+				t.Fatalf("OK = %v, want %v", v.OK(), wantOK)
+			}
+			if v.OK() != (len(v.Errors) == 0) {
+				t.Fatalf("OK = %v with errors %v", v.OK(), v.Errors)
+			}
+		})
+	}
+}
@@ -2,16 +2,18 @@ package watcher
 
 import (
 	"errors"
-	"log"
 	"os"
 	"sync"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // Watcher is a utility that can watch for updates
 type Watcher struct {
 	file *File
 	stop chan struct{}
+	once sync.Once
 }
 
 // NewWatcher constructs a new watcher for the given file
@@ -24,9 +26,10 @@ func NewWatcher(file *File) *Watcher {
 	return w
 }
 
-// Stop stops the watcher from watching the file
+// Stop stops the watcher from watching the file. It is safe to call
+// Stop after the watcher has stopped on its own
 func (w *Watcher) Stop() {
-	w.stop <- struct{}{}
+	w.once.Do(func() { close(w.stop) })
 	w.file.detachWatcher()
 }
 
@@ -36,8 +39,9 @@ func (w *Watcher) Start(
 	errs chan<- error,
 	removals chan<- FilePath,
 	additions chan<- FilePath,
+	emit func(Event),
 ) {
-	go w.watch(interval, errs, removals, additions)
+	go w.watch(interval, errs, removals, additions, emit)
 }
 
 func (w *Watcher) watch(
@@ -45,11 +49,12 @@ func (w *Watcher) watch(
 	errs chan<- error,
 	removals chan<- FilePath,
 	additions chan<- FilePath,
+	emit func(Event),
 ) {
 
 	checksum, err := w.file.Checksum()
 	if err != nil {
-		log.Printf("ERR: %+v\n", err)
+		log.WithFields(log.Fields{"path": w.file.AbsolutePath, "op": "watch"}).WithError(err).Error("could not checksum file")
 		errs <- err
 		return
 	}
@@ -64,25 +69,25 @@ func (w *Watcher) watch(
 		case <-w.stop:
 			return
 		case err := <-internalErrs:
-			log.Printf("ERR: %+v\n", err)
+			log.WithFields(log.Fields{"path": w.file.AbsolutePath, "op": "watch"}).WithError(err).Error("could not check file for changes")
 			errs <- err
 			return
 		case updatedChecksum := <-checksumUpdates:
-			log.Printf("file %s changed\n", w.file.AbsolutePath)
+			log.WithFields(log.Fields{"path": w.file.AbsolutePath, "op": "watch"}).Info("file changed")
 			mux.Lock()
 			checksum = updatedChecksum
 			mux.Unlock()
 		case <-tick.C:
 			_, err := os.Stat(w.file.AbsolutePath.String())
 			if errors.Is(err, os.ErrNotExist) {
-				log.Printf("file %s has been removed\n", w.file.AbsolutePath)
+				log.WithFields(log.Fields{"path": w.file.AbsolutePath, "op": "watch"}).Info("file removed")
 				removals <- w.file.AbsolutePath
 				return
 			} else if err != nil {
 				errs <- err
 				return
 			}
-			go w.checkFileUpdated(checksum, internalErrs, checksumUpdates, additions)
+			go w.checkFileUpdated(checksum, internalErrs, checksumUpdates, additions, emit)
 		}
 	}
 }
@@ -92,12 +97,19 @@ func (w *Watcher) checkFileUpdated(
 	errs chan<- error,
 	updates chan<- [32]byte,
 	additions chan<- FilePath,
+	emit func(Event),
 ) {
+	started := time.Now()
 	cs, err := w.file.Checksum()
 	if err != nil {
 		errs <- err
 		return
 	}
+	emit(Event{
+		Type:         EventPoll,
+		AbsolutePath: w.file.AbsolutePath,
+		Duration:     time.Since(started),
+	})
 
 	if cs != checksum {
 		additions <- w.file.AbsolutePath